@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -40,18 +41,65 @@ type JSONToken struct {
 	} `json:"installed"`
 }
 
+// Tap receives a copy of the audio and text of each conversation, e.g. to
+// record it.
+type Tap interface {
+	MicAudio(data []byte)
+	ReplyAudio(data []byte)
+	Transcript(request, response string)
+}
+
+// Taps is a Tap copying each conversation to all of its Taps.
+type Taps []Tap
+
+func (t Taps) MicAudio(data []byte) {
+	for _, tap := range t {
+		tap.MicAudio(data)
+	}
+}
+
+func (t Taps) ReplyAudio(data []byte) {
+	for _, tap := range t {
+		tap.ReplyAudio(data)
+	}
+}
+
+func (t Taps) Transcript(request, response string) {
+	for _, tap := range t {
+		tap.Transcript(request, response)
+	}
+}
+
+// Result is the outcome of a conversation turn.
+type Result struct {
+	RequestText  string         // What the assistant heard the user say.
+	ResponseText string         // What the assistant said; often empty.
+	Audio        *bytes.Buffer  // The complete reply audio.
+	Session      *audio.Session // Playback of the reply.
+	State        []byte         // Conversation state the next turn continues.
+	Errors       []error        // Errors the assistant reported along the way.
+}
+
 type GAssistant struct {
 	audio       *audio.Audio
 	oauthConfig *oauth2.Config
 	oauthToken  *oauth2.Token
 	secretsFile string
 	scopes      []string
-	StatusCh    chan embedded.ConverseResponse_EventType // Status channel signals end_of_utterance.
+	voiceGate   bool
+	tap         Tap
+	options     []option.ClientOption                    // Connect with these instead of the Auth credentials; nil for Google.
+	convState   []byte                                   // State of the last conversation turn.
+	StatusCh    chan embedded.ConverseResponse_EventType // Status channel signals end_of_utterance once the mic is released.
+
+	lock   sync.Mutex // Guards cancel and reply.
+	cancel context.CancelFunc
+	reply  *audio.Session
 }
 
 func New() *GAssistant {
 	return &GAssistant{
-		StatusCh: make(chan embedded.ConverseResponse_EventType),
+		StatusCh: make(chan embedded.ConverseResponse_EventType, 1),
 	}
 }
 
@@ -62,6 +110,36 @@ func (s *GAssistant) Init(audio *audio.Audio, secretsFile string, scope string)
 	return nil
 }
 
+// SetVoiceGate enables dropping leading silence from the mic and closing the
+// mic once the user stops talking, instead of streaming dead air.
+func (s *GAssistant) SetVoiceGate(on bool) {
+	s.voiceGate = on
+}
+
+// SetTap sets the Tap for following conversations; nil removes it.
+func (s *GAssistant) SetTap(t Tap) {
+	s.tap = t
+}
+
+// SetOptions makes conversations connect with opts instead of the
+// credentials of Auth, e.g. to talk to a local server.
+func (s *GAssistant) SetOptions(opts ...option.ClientOption) {
+	s.options = opts
+}
+
+// Cancel stops the conversation in progress, if any, and the playback of the
+// last reply, e.g. when the user interrupts.
+func (s *GAssistant) Cancel() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.reply != nil {
+		s.reply.Cancel()
+	}
+}
+
 func (s *GAssistant) loadTokenSource() error {
 	f, err := os.Open("oauthTokenCache")
 	if err != nil {
@@ -110,21 +188,33 @@ func (s *GAssistant) Auth() error {
 	return fmt.Errorf("failed to load token %v", err)
 }
 
-func (s *GAssistant) ConverseWithAssistant() *bytes.Buffer {
+// ConverseWithAssistant runs one conversation turn. It returns an error if
+// the conversation failed or was canceled.
+func (s *GAssistant) ConverseWithAssistant() (*Result, error) {
 	glog.V(1).Infof("Waiting for new conversation...")
-	var convState []byte
-	micStopCh := make(chan struct{})
+	micStopCh := make(chan struct{}, 1) // Buffered as the voice gate may have closed the mic already.
+	micDone := make(chan struct{})
+	tap := s.tap
 
 	ctx, canceler := context.WithTimeout(context.Background(), MAX_RUNTIME*time.Second)
-	tokenSource := s.oauthConfig.TokenSource(ctx, s.oauthToken)
+	session := s.audio.NewSession()
+	s.lock.Lock()
+	s.cancel = canceler
+	s.reply = session
+	s.lock.Unlock()
 
-	conn, err := transport.DialGRPC(ctx,
-		option.WithTokenSource(tokenSource),
-		option.WithEndpoint(API_ENDPOINT),
-		option.WithScopes(s.scopes[0]),
-	)
+	opts := s.options
+	if opts == nil {
+		opts = []option.ClientOption{
+			option.WithTokenSource(s.oauthConfig.TokenSource(ctx, s.oauthToken)),
+			option.WithEndpoint(API_ENDPOINT),
+			option.WithScopes(s.scopes[0]),
+		}
+	}
+	conn, err := transport.DialGRPC(ctx, opts...)
 	if err != nil {
-		glog.Fatalf("Failed to connect with rpc endpoint: %v", err)
+		canceler()
+		return nil, fmt.Errorf("failed to connect with rpc endpoint: %v", err)
 	}
 
 	// Clean up before finishing up.
@@ -135,6 +225,13 @@ func (s *GAssistant) ConverseWithAssistant() *bytes.Buffer {
 		canceler()
 	}()
 
+	// The assistant works out relative volume changes from the current
+	// volume, which must be 1 to 100.
+	volume := s.audio.GetVolume()
+	if volume < 1 {
+		volume = 1
+	}
+
 	assistant := embedded.NewEmbeddedAssistantClient(conn)
 	config := &embedded.ConverseRequest_Config{
 		Config: &embedded.ConverseConfig{
@@ -145,59 +242,114 @@ func (s *GAssistant) ConverseWithAssistant() *bytes.Buffer {
 			AudioOutConfig: &embedded.AudioOutConfig{
 				Encoding:         embedded.AudioOutConfig_LINEAR16,
 				SampleRateHertz:  16000,
-				VolumePercentage: 70,
+				VolumePercentage: int32(volume),
 			},
 		},
 	}
 
-	// TODO: add conversation state.
-	if len(convState) > 0 {
+	if len(s.convState) > 0 {
 		glog.V(2).Infof("continuing conversation")
-		config.Config.ConverseState = &embedded.ConverseState{ConversationState: convState}
+		config.Config.ConverseState = &embedded.ConverseState{ConversationState: s.convState}
 	}
 
 	conversation, err := assistant.Converse(ctx)
 	if err != nil {
-		glog.Errorf("Failed to setup the conversation: %v", err)
-		return nil
+		return nil, fmt.Errorf("failed to setup the conversation: %v", err)
 	}
 
 	req := &embedded.ConverseRequest{
 		ConverseRequest: config,
 	}
 	if err := conversation.Send(req); err != nil {
-		glog.Errorf("Failed to send to Google Assistant: %v", err)
-		return nil
+		return nil, fmt.Errorf("failed to send to Google Assistant: %v", err)
 	}
 
 	// Get Audio from mic and send to Assistant.
 	go func() {
+		defer close(micDone)
 		s.audio.StartListen()
+		vad := audio.NewVAD(audio.DefaultVADConfig())
+		spoken := false
+		var preroll []byte // Last silent buffer, sent ahead of speech for context.
+
+		stopMic := func() {
+			glog.V(2).Infof("Turning off mic")
+			conversation.CloseSend()
+			s.audio.StopListen()
+		}
+		send := func(data []byte) {
+			req := &embedded.ConverseRequest{
+				ConverseRequest: &embedded.ConverseRequest_AudioIn{
+					AudioIn: data,
+				},
+			}
+			if err := conversation.Send(req); err != nil {
+				glog.Errorf("Failed to send audio to Google Assistant: %v", err)
+			}
+			if tap != nil {
+				tap.MicAudio(data)
+			}
+		}
+
 		for {
 			select {
 			// Close the send of conversation and return from goroutine.
 			case <-micStopCh:
-				glog.V(2).Infof("Turning off mic")
-				conversation.CloseSend()
-				s.audio.StopListen()
+				stopMic()
+				return
+
+			case <-ctx.Done():
+				stopMic()
 				return
 
 			// Audio data available from mic.
 			case buff := <-s.audio.In:
-				req = &embedded.ConverseRequest{
-					ConverseRequest: &embedded.ConverseRequest_AudioIn{
-						AudioIn: buff.Bytes(),
-					},
+				if !s.voiceGate {
+					send(buff.Bytes())
+					continue
+				}
+
+				ended := false
+				for _, e := range vad.Process(audio.BytesToSamples(buff.Bytes())) {
+					switch e.Type {
+					case audio.VAD_SPEECH_START:
+						spoken = true
+					case audio.VAD_SPEECH_END:
+						ended = true
+					}
+				}
+				if !spoken {
+					preroll = buff.Bytes()
+					continue
+				}
+				if preroll != nil {
+					send(preroll)
+					preroll = nil
 				}
-				if err := conversation.Send(req); err != nil {
-					glog.Errorf("Failed to send audio to Google Assistant: %v", err)
+				send(buff.Bytes())
+				if ended && !vad.Talking() {
+					glog.V(2).Infof("User stopped talking")
+					stopMic()
+					return
 				}
 			}
 		}
 
 	}()
 
-	var fullAudio bytes.Buffer
+	// Release the mic before returning.
+	defer func() {
+		select {
+		case micStopCh <- struct{}{}:
+		default:
+		}
+		<-micDone
+	}()
+
+	res := &Result{
+		Audio:   &bytes.Buffer{},
+		Session: session,
+	}
 	// Process audio returned from assistant.
 	for {
 		resp, err := conversation.Recv()
@@ -205,34 +357,69 @@ func (s *GAssistant) ConverseWithAssistant() *bytes.Buffer {
 		switch {
 		case err == io.EOF:
 			glog.V(2).Infof("Got EOF from Assistant API")
-			return &fullAudio
+			session.End()
+			return res, nil
+
+		case ctx.Err() != nil:
+			glog.V(1).Infof("Conversation canceled: %v", ctx.Err())
+			session.Cancel()
+			return nil, ctx.Err()
 
 		case err != nil:
-			glog.Errorf("Failed to recieve a response from assistant: %v", err)
-			continue
+			session.Cancel()
+			return nil, fmt.Errorf("failed to recieve a response from assistant: %v", err)
 		}
 
 		if err := resp.GetError(); err != nil {
 			glog.Errorf("Received error from the assistant: %v", err)
+			res.Errors = append(res.Errors, fmt.Errorf("assistant error: %v", err.GetMessage()))
 		}
 
 		result := resp.GetResult()
 		if result != nil {
 			glog.V(1).Infof("data %s- %s", result.SpokenResponseText, result.SpokenRequestText)
+			if result.SpokenRequestText != "" {
+				res.RequestText = result.SpokenRequestText
+			}
+			if result.SpokenResponseText != "" {
+				res.ResponseText = result.SpokenResponseText
+			}
+			if len(result.ConversationState) > 0 {
+				res.State = result.ConversationState
+				s.convState = result.ConversationState
+			}
+			if tap != nil {
+				tap.Transcript(result.SpokenRequestText, result.SpokenResponseText)
+			}
+			// The user asked to change the volume.
+			if v := result.VolumePercentage; v != 0 {
+				glog.V(1).Infof("Assistant set volume to %v%%", v)
+				s.audio.SetVolume(int(v))
+			}
 		}
 
 		if resp.GetEventType() == embedded.ConverseResponse_END_OF_UTTERANCE {
-			micStopCh <- struct{}{}
-			//	go func() { //TODO: Does this need to be in a go func?.Probably not.
-			s.StatusCh <- embedded.ConverseResponse_END_OF_UTTERANCE
-			//	}()
+			select {
+			case micStopCh <- struct{}{}:
+			default:
+			}
+			go func() {
+				<-micDone
+				select {
+				case s.StatusCh <- embedded.ConverseResponse_END_OF_UTTERANCE:
+				default:
+					glog.V(3).Infof("No one is reading assistant status, dropping END_OF_UTTERANCE")
+				}
+			}()
 		}
 		audioOut := resp.GetAudioOut()
 		if audioOut != nil {
 			glog.V(4).Infof("audio out from the assistant (%d bytes)\n", len(audioOut.AudioData))
-			signal := bytes.NewBuffer(audioOut.AudioData)
-			fullAudio.Write(audioOut.AudioData)
-			s.audio.Out <- *signal // Send audio to AudioOut Channel.
+			res.Audio.Write(audioOut.AudioData)
+			if tap != nil {
+				tap.ReplyAudio(audioOut.AudioData)
+			}
+			session.Play(audioOut.AudioData)
 		}
 	}
 }
@@ -0,0 +1,274 @@
+package assistant
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deepakkamesh/walle/audio"
+	"google.golang.org/api/option"
+	embedded "google.golang.org/genproto/googleapis/assistant/embedded/v1alpha1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// fakeAssistant is a local Embedded Assistant server. Each conversation ends
+// the utterance once mic audio arrives, and after the mic closes answers with
+// the next of its scripted turns. If hang is set it never answers, closing
+// hung once the conversation started.
+type fakeAssistant struct {
+	embedded.UnimplementedEmbeddedAssistantServer
+
+	hang  bool
+	hung  chan struct{}
+	turns []fakeTurn
+
+	lock    sync.Mutex
+	configs []*embedded.ConverseConfig // Received, by conversation.
+	mic     int                        // Mic bytes received.
+}
+
+type fakeTurn struct {
+	reply  []int16
+	result *embedded.ConverseResult
+}
+
+func (s *fakeAssistant) Converse(stream embedded.EmbeddedAssistant_ConverseServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	turn := s.turns[len(s.configs)%len(s.turns)]
+	s.configs = append(s.configs, req.GetConfig())
+	s.lock.Unlock()
+	if s.hang {
+		close(s.hung)
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	ended := false
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.mic += len(req.GetAudioIn())
+		s.lock.Unlock()
+		if !ended {
+			ended = true
+			if err := stream.Send(&embedded.ConverseResponse{
+				ConverseResponse: &embedded.ConverseResponse_EventType_{EventType: embedded.ConverseResponse_END_OF_UTTERANCE},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	data := audio.SamplesToBytes(turn.reply)
+	for len(data) > 0 {
+		n := len(data)
+		if n > 1600 {
+			n = 1600
+		}
+		if err := stream.Send(&embedded.ConverseResponse{
+			ConverseResponse: &embedded.ConverseResponse_AudioOut{AudioOut: &embedded.AudioOut{AudioData: data[:n]}},
+		}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return stream.Send(&embedded.ConverseResponse{
+		ConverseResponse: &embedded.ConverseResponse_Result{Result: turn.result},
+	})
+}
+
+// config returns the config of conversation i.
+func (s *fakeAssistant) config(i int) *embedded.ConverseConfig {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.configs[i]
+}
+
+// micBytes returns the mic bytes received.
+func (s *fakeAssistant) micBytes() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.mic
+}
+
+// recordingTap is a Tap keeping all it gets.
+type recordingTap struct {
+	mic, reply  bytes.Buffer
+	transcripts []string
+}
+
+func (t *recordingTap) MicAudio(data []byte)   { t.mic.Write(data) }
+func (t *recordingTap) ReplyAudio(data []byte) { t.reply.Write(data) }
+func (t *recordingTap) Transcript(request, response string) {
+	t.transcripts = append(t.transcripts, request+"|"+response)
+}
+
+// newTestAssistant returns an assistant talking to fake on audio played
+// through a loopback backend.
+func newTestAssistant(t *testing.T, fake *fakeAssistant) (*GAssistant, *audio.Loopback) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	embedded.RegisterEmbeddedAssistantServer(server, fake)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	lb := audio.NewLoopback()
+	a := audio.NewWithBackend(lb)
+	if err := a.Init(); err != nil {
+		t.Fatalf("audio Init: %v", err)
+	}
+	a.SetAGC(audio.AGCConfig{})
+	a.StartPlayback()
+	t.Cleanup(a.Quit)
+	t.Cleanup(a.StopPlayback)
+
+	s := New()
+	if err := s.Init(a, "", ""); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	s.SetOptions(
+		option.WithEndpoint(l.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	return s, lb
+}
+
+func testTone(n int) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/audio.SAMPLE_RATE))
+	}
+	return out
+}
+
+func TestConverse(t *testing.T) {
+	reply := testTone(audio.SAMPLE_RATE / 2)
+	fake := &fakeAssistant{turns: []fakeTurn{
+		{reply: reply, result: &embedded.ConverseResult{
+			SpokenRequestText:  "hello",
+			SpokenResponseText: "hi there",
+			ConversationState:  []byte("turn 1"),
+		}},
+		{reply: reply[:100], result: &embedded.ConverseResult{
+			SpokenRequestText: "louder",
+			VolumePercentage:  60,
+		}},
+	}}
+	s, lb := newTestAssistant(t, fake)
+	tap := &recordingTap{}
+	s.SetTap(tap)
+
+	res, err := s.ConverseWithAssistant()
+	if err != nil {
+		t.Fatalf("ConverseWithAssistant: %v", err)
+	}
+	if res.RequestText != "hello" || res.ResponseText != "hi there" || string(res.State) != "turn 1" {
+		t.Errorf("got request %q, response %q and state %q", res.RequestText, res.ResponseText, res.State)
+	}
+	if !bytes.Equal(res.Audio.Bytes(), audio.SamplesToBytes(reply)) {
+		t.Errorf("got %v bytes of reply audio, want %v", res.Audio.Len(), len(reply)*2)
+	}
+	select {
+	case <-res.Session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply didn't finish playing")
+	}
+	played := lb.Played()
+	if len(played) < len(reply) {
+		t.Fatalf("played %v samples, want at least %v", len(played), len(reply))
+	}
+	for i := range reply {
+		if played[i] != reply[i] {
+			t.Fatalf("played sample %v is %v, want %v", i, played[i], reply[i])
+		}
+	}
+
+	select {
+	case ev := <-s.StatusCh:
+		if ev != embedded.ConverseResponse_END_OF_UTTERANCE {
+			t.Errorf("got status %v, want END_OF_UTTERANCE", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no END_OF_UTTERANCE status")
+	}
+	c := fake.config(0)
+	if v := c.GetAudioOutConfig().GetVolumePercentage(); v != 100 {
+		t.Errorf("reported volume %v, want 100", v)
+	}
+	if c.GetConverseState() != nil {
+		t.Errorf("first turn continued conversation %q", c.GetConverseState().GetConversationState())
+	}
+	if n := fake.micBytes(); n == 0 || tap.mic.Len() != n {
+		t.Errorf("tapped %v mic bytes, server got %v", tap.mic.Len(), n)
+	}
+	if !bytes.Equal(tap.reply.Bytes(), res.Audio.Bytes()) {
+		t.Errorf("tapped %v reply bytes, want %v", tap.reply.Len(), res.Audio.Len())
+	}
+	if len(tap.transcripts) != 1 || tap.transcripts[0] != "hello|hi there" {
+		t.Errorf("tapped transcripts %q", tap.transcripts)
+	}
+
+	// The next turn continues the conversation, reporting the volume in the
+	// range the assistant accepts, and the assistant may change it.
+	s.audio.SetVolume(0)
+	res, err = s.ConverseWithAssistant()
+	if err != nil {
+		t.Fatalf("second ConverseWithAssistant: %v", err)
+	}
+	res.Session.Wait()
+	c = fake.config(1)
+	if got := string(c.GetConverseState().GetConversationState()); got != "turn 1" {
+		t.Errorf("second turn continued conversation %q, want %q", got, "turn 1")
+	}
+	if v := c.GetAudioOutConfig().GetVolumePercentage(); v != 1 {
+		t.Errorf("reported volume %v at mute, want 1", v)
+	}
+	if v := s.audio.GetVolume(); v != 60 {
+		t.Errorf("volume is %v, want 60 as the assistant set", v)
+	}
+}
+
+func TestConverseCancel(t *testing.T) {
+	fake := &fakeAssistant{hang: true, hung: make(chan struct{}), turns: []fakeTurn{{}}}
+	s, _ := newTestAssistant(t, fake)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ConverseWithAssistant()
+		done <- err
+	}()
+	select {
+	case <-fake.hung:
+	case <-time.After(5 * time.Second):
+		t.Fatal("conversation didn't start")
+	}
+	s.Cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("canceled conversation succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cancel didn't stop the conversation")
+	}
+}
@@ -0,0 +1,196 @@
+package audio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AGC_WINDOW = SAMPLE_RATE / 100 // Samples per gain update, 10ms.
+)
+
+// AGCConfig tunes the mic automatic gain control and noise gate, which are
+// enabled separately. Levels are RMS relative to full scale.
+type AGCConfig struct {
+	Enabled       bool          `json:"enabled"`
+	Target        float64       `json:"target"`   // Level the AGC aims for.
+	MaxGain       float64       `json:"max_gain"` // Most the AGC boosts quiet input.
+	Attack        time.Duration `json:"attack"`   // Time to turn down loud input, or open the gate.
+	Release       time.Duration `json:"release"`  // Time to turn up quiet input, or close the gate.
+	GateEnabled   bool          `json:"gate_enabled"`
+	GateThreshold float64       `json:"gate_threshold"` // Input quieter than this is muted; 0 disables the gate.
+}
+
+// DefaultAGCConfig returns settings for speech; the AGC and gate are
+// disabled.
+func DefaultAGCConfig() AGCConfig {
+	return AGCConfig{
+		Target:        0.1,
+		MaxGain:       10,
+		Attack:        20 * time.Millisecond,
+		Release:       500 * time.Millisecond,
+		GateThreshold: 0.005,
+	}
+}
+
+// AGC applies automatic gain control and a noise gate to a stream. The gain
+// is held while input is below the gate threshold so noise isn't boosted.
+type AGC struct {
+	c      AGCConfig
+	window []int16 // Partial window carried over between Process calls.
+	gain   float64
+	gate   float64 // 0 closed to 1 open.
+}
+
+func NewAGC(c AGCConfig) *AGC {
+	return &AGC{
+		c:    c,
+		gain: 1,
+		gate: 1,
+	}
+}
+
+// Process returns the next samples of the stream with gain applied. Output
+// lags input by up to AGC_WINDOW samples.
+func (s *AGC) Process(samples []int16) []int16 {
+	out := make([]int16, 0, len(samples)+len(s.window))
+	for len(samples) > 0 {
+		n := AGC_WINDOW - len(s.window)
+		if n > len(samples) {
+			n = len(samples)
+		}
+		s.window = append(s.window, samples[:n]...)
+		samples = samples[n:]
+		if len(s.window) == AGC_WINDOW {
+			out = append(out, s.apply(s.window)...)
+			s.window = s.window[:0]
+		}
+	}
+	return out
+}
+
+// apply updates the gain from window and applies it, ramping from the last
+// gain to avoid zipper noise.
+func (s *AGC) apply(window []int16) []int16 {
+	var sum float64
+	for _, v := range window {
+		f := float64(v) / -math.MinInt16
+		sum += f * f
+	}
+	rms := math.Sqrt(sum / float64(len(window)))
+
+	gain, gate := s.gain, s.gate
+	open := rms >= s.c.GateThreshold
+	if s.c.Enabled && open {
+		want := s.c.MaxGain
+		if rms > 0 && s.c.Target/rms < want {
+			want = s.c.Target / rms
+		}
+		if want < gain {
+			gain += (want - gain) * s.coeff(s.c.Attack)
+		} else {
+			gain += (want - gain) * s.coeff(s.c.Release)
+		}
+	}
+	switch {
+	case !s.c.GateEnabled || open:
+		gate += (1 - gate) * s.coeff(s.c.Attack)
+	default:
+		gate -= gate * s.coeff(s.c.Release)
+	}
+
+	out := make([]int16, len(window))
+	for i, v := range window {
+		t := float64(i+1) / float64(len(window))
+		g := (s.gain + (gain-s.gain)*t) * (s.gate + (gate-s.gate)*t)
+		out[i] = clip(float64(v) * g)
+	}
+	s.gain, s.gate = gain, gate
+	return out
+}
+
+// coeff returns the smoothing factor per window for time constant d.
+func (s *AGC) coeff(d time.Duration) float64 {
+	if d <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-float64(AGC_WINDOW)/SAMPLE_RATE/d.Seconds())
+}
+
+// SetAGC changes the mic gain control settings.
+func (s *Audio) SetAGC(c AGCConfig) {
+	s.agcLock.Lock()
+	defer s.agcLock.Unlock()
+	s.agcConfig = c
+	s.agc = NewAGC(c)
+}
+
+// GetAGC returns the mic gain control settings.
+func (s *Audio) GetAGC() AGCConfig {
+	s.agcLock.Lock()
+	defer s.agcLock.Unlock()
+	return s.agcConfig
+}
+
+// processAGC runs mic samples through the AGC and noise gate if either is
+// enabled.
+func (s *Audio) processAGC(samples []int16) []int16 {
+	s.agcLock.Lock()
+	defer s.agcLock.Unlock()
+	if !s.agcConfig.Enabled && !s.agcConfig.GateEnabled {
+		return samples
+	}
+	return s.agc.Process(samples)
+}
+
+// AGCSettings are AGC settings by device name, persisted as JSON.
+type AGCSettings struct {
+	lock    sync.Mutex
+	fname   string
+	devices map[string]AGCConfig
+}
+
+// LoadAGCSettings reads the settings in fname. A missing file has no
+// settings.
+func LoadAGCSettings(fname string) (*AGCSettings, error) {
+	s := &AGCSettings{
+		fname:   fname,
+		devices: make(map[string]AGCConfig),
+	}
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the settings of device, or false if there are none.
+func (s *AGCSettings) Get(device string) (AGCConfig, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.devices[device]
+	return c, ok
+}
+
+// Set stores the settings of device and saves them.
+func (s *AGCSettings) Set(device string, c AGCConfig) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.devices[device] = c
+
+	data, err := json.MarshalIndent(s.devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.fname, data, 0644)
+}
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// rms returns the level of samples relative to full scale.
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, v := range samples {
+		f := float64(v) / -math.MinInt16
+		sum += f * f
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// constant returns n samples alternating between v and -v.
+func constant(n int, v int16) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = v
+		if i%2 == 1 {
+			out[i] = -v
+		}
+	}
+	return out
+}
+
+func TestNoiseGateWithoutAGC(t *testing.T) {
+	c := DefaultAGCConfig()
+	c.GateEnabled = true
+	a := NewAGC(c)
+
+	// Noise below the threshold fades out as the gate closes...
+	noise := a.Process(constant(3*SAMPLE_RATE, 50))
+	if l, in := rms(noise[len(noise)-AGC_WINDOW:]), rms(constant(AGC_WINDOW, 50)); l > in/100 {
+		t.Errorf("noise level %v through the closed gate, from %v", l, in)
+	}
+	// ...and speech passes at its own level, as the AGC is off.
+	speech := a.Process(constant(SAMPLE_RATE, 1000))
+	if l, want := rms(speech[len(speech)-AGC_WINDOW:]), rms(constant(AGC_WINDOW, 1000)); math.Abs(l-want) > want/100 {
+		t.Errorf("speech level %v through the open gate, want %v", l, want)
+	}
+}
+
+func TestAGCWithoutNoiseGate(t *testing.T) {
+	c := DefaultAGCConfig()
+	c.Enabled = true
+	a := NewAGC(c)
+
+	// Quiet input isn't muted, nor boosted.
+	noise := a.Process(constant(SAMPLE_RATE, 50))
+	if l, want := rms(noise[len(noise)-AGC_WINDOW:]), rms(constant(AGC_WINDOW, 50)); math.Abs(l-want) > want/10 {
+		t.Errorf("noise level %v, want %v", l, want)
+	}
+	// Speech is brought to the target.
+	speech := a.Process(constant(2*SAMPLE_RATE, 1000))
+	if l := rms(speech[len(speech)-AGC_WINDOW:]); math.Abs(l-c.Target) > c.Target/10 {
+		t.Errorf("speech level %v, want %v", l, c.Target)
+	}
+}
+
+func TestProcessAGCDisabled(t *testing.T) {
+	a := NewWithBackend(NewLoopback())
+	a.SetAGC(DefaultAGCConfig())
+	in := constant(AGC_WINDOW, 50)
+	if out := a.processAGC(in); &out[0] != &in[0] {
+		t.Errorf("samples processed with the AGC and gate disabled")
+	}
+	c := DefaultAGCConfig()
+	c.GateEnabled = true
+	a.SetAGC(c)
+	if out := a.processAGC(in); &out[0] == &in[0] {
+		t.Errorf("samples not processed with the gate enabled")
+	}
+}
@@ -3,66 +3,125 @@ package audio
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/gordonklaus/portaudio"
 )
 
 const (
-	PLAYBACK_DONE byte = 1
+	SAMPLE_RATE = 16000
+	IN_FRAMES   = 8196 // Frames per mic read, at SAMPLE_RATE.
+	OUT_FRAMES  = 799  // Frames per mixed output buffer, at SAMPLE_RATE.
 )
 
 type Audio struct {
 	In           chan bytes.Buffer
-	Out          chan bytes.Buffer
-	streamIn     *portaudio.Stream
-	streamOut    *portaudio.Stream
-	bufIn        []int16
-	bufOut       []int16
+	VoiceCh      chan VADEvent // Speech start/end on the mic while listening.
+	Events       chan Event    // Streams failing and recovering.
+	vad          *VAD
+	mixer        *mixer
+	clips        *ClipCache
+	levels       *levels
+	backend      Backend
+	streamLock   sync.RWMutex     // Write locked while reopening streams.
+	streamIn     Source           // nil while down.
+	streamOut    Sink             // nil while down.
+	stateLock    sync.Mutex       // Guards failed, running, recovered and recovering.
+	failed       [2]bool          // By direction.
+	running      [2]bool          // By direction; started streams.
+	recovered    [2]chan struct{} // By direction; closed once reopened, nil if not failed.
+	recovering   bool             // Recovery is running.
+	outDown      <-chan struct{}  // Output recovery playback waits for.
+	bufIn        []int16          // Device format.
+	bufOut       []int16          // Device format.
+	mixBuf       []int16          // DEFAULT_FORMAT output before conversion.
+	inConv       *Converter       // Device to DEFAULT_FORMAT.
+	outConv      *Converter       // DEFAULT_FORMAT to device.
+	outPending   []int16          // Converted output not yet filling bufOut.
 	listenStop   chan struct{}
 	playbackStop chan struct{}
-	StatusCh     chan byte
+	quit         chan struct{}
+	overruns     uint64 // Atomic; mic buffers dropped.
+	agcLock      sync.Mutex
+	agcConfig    AGCConfig
+	agc          *AGC
+	voices       voices
 }
 
+// Stats counts audio glitches.
+type Stats struct {
+	Underruns uint64 // Times a playing session ran out of audio.
+	Overruns  uint64 // Mic buffers dropped as no one read them.
+}
+
+// Stats returns the glitches since Init.
+func (s *Audio) Stats() Stats {
+	s.mixer.lock.Lock()
+	defer s.mixer.lock.Unlock()
+	return Stats{
+		Underruns: s.mixer.underruns,
+		Overruns:  atomic.LoadUint64(&s.overruns),
+	}
+}
+
+// New returns an Audio on the default portaudio devices.
 func New() *Audio {
+	return NewWithBackend(NewPortAudio())
+}
+
+// NewWithBackend returns an Audio that captures and plays through b.
+func NewWithBackend(b Backend) *Audio {
 	return &Audio{
+		backend:      b,
 		In:           make(chan bytes.Buffer, 10),
-		Out:          make(chan bytes.Buffer, 1000),
+		VoiceCh:      make(chan VADEvent, 10),
+		Events:       make(chan Event, 10),
+		mixer:        newMixer(),
+		clips:        NewClipCache(),
+		levels:       newLevels(),
 		listenStop:   make(chan struct{}),
 		playbackStop: make(chan struct{}),
-		StatusCh:     make(chan byte, 10), // See TODO:(end_detect) below.
+		quit:         make(chan struct{}),
+		agcConfig:    DefaultAGCConfig(),
+		agc:          NewAGC(DefaultAGCConfig()),
 	}
 }
 
+// Init opens the audio streams. Devices that can't be opened are retried in
+// the background, reported on Events.
 func (s *Audio) Init() error {
-	if err := portaudio.Initialize(); err != nil {
+	if err := s.backend.Init(); err != nil {
 		return err
 	}
 
-	// Open Input stream.
-	bufIn := make([]int16, 8196)
-	in, err := portaudio.OpenDefaultStream(1, 0, 16000, len(bufIn), bufIn)
-	if err != nil {
-		return err
-	}
+	inFormat, outFormat := s.backend.Formats()
+	glog.V(1).Infof("Audio device formats in:%+v out:%+v", inFormat, outFormat)
 
-	s.streamIn = in
-	s.bufIn = bufIn
+	s.bufIn = make([]int16, deviceSamples(IN_FRAMES, inFormat))
+	s.inConv = NewConverter(inFormat, DEFAULT_FORMAT)
+	s.bufOut = make([]int16, deviceSamples(OUT_FRAMES, outFormat))
+	s.mixBuf = make([]int16, OUT_FRAMES)
+	s.outConv = NewConverter(DEFAULT_FORMAT, outFormat)
 
-	// Open Output stream.
-	bufOut := make([]int16, 799)
-	out, err := portaudio.OpenDefaultStream(0, 1, 16000, len(bufOut), bufOut)
-	if err != nil {
-		return err
+	for _, dir := range []byte{DIR_IN, DIR_OUT} {
+		s.streamLock.Lock()
+		err := s.open(dir)
+		s.streamLock.Unlock()
+		if err != nil {
+			s.fail(dir, err)
+		}
 	}
-
-	s.streamOut = out
-	s.bufOut = bufOut
-
 	return nil
 }
 
+// deviceSamples returns the buffer length in format f holding the same time
+// as frames at SAMPLE_RATE.
+func deviceSamples(frames int, f Format) int {
+	return frames * f.Rate / SAMPLE_RATE * f.Channels
+}
+
 func (s *Audio) StartPlayback() {
 	go s.playback()
 }
@@ -75,6 +134,29 @@ func (s *Audio) StopListen() {
 	s.listenStop <- struct{}{}
 }
 
+// DrainIn discards mic audio no one read, so the next listener doesn't get
+// stale audio.
+func (s *Audio) DrainIn() {
+	for {
+		select {
+		case <-s.In:
+		default:
+			return
+		}
+	}
+}
+
+// DrainVoice discards voice activity events no one read.
+func (s *Audio) DrainVoice() {
+	for {
+		select {
+		case <-s.VoiceCh:
+		default:
+			return
+		}
+	}
+}
+
 func (s *Audio) StopPlayback() {
 	s.playbackStop <- struct{}{}
 }
@@ -94,26 +176,53 @@ func (s *Audio) listen() {
 	if len(s.In) > 0 {
 		glog.Warningf("Audio input channel is non zero: %v", len(s.In))
 	}
-	if err := s.streamIn.Start(); err != nil {
-		glog.Fatalf("Failed to start input stream: %v ", err)
-	}
+	s.vad = NewVAD(DefaultVADConfig())
+	down := s.startStream(DIR_IN)
 
 	listenFunc := func() {
-		if err := s.streamIn.Read(); err != nil {
-			glog.Errorf("Failed to read input stream: %v", err)
+		if err := s.read(); err != nil {
+			down = s.fail(DIR_IN, err)
+			return
+		}
+
+		samples := s.processAGC(s.inConv.Convert(s.bufIn))
+		s.levels.add(DIR_IN, samples)
+		for _, e := range s.vad.Process(samples) {
+			glog.V(3).Infof("Voice activity %v at sample %v", e.Type, e.Offset)
+			select {
+			case s.VoiceCh <- e:
+			default:
+				glog.V(3).Infof("No one is reading voice activity, dropping event")
+			}
 		}
 
 		var bufWriter bytes.Buffer
-		binary.Write(&bufWriter, binary.LittleEndian, s.bufIn)
-		s.In <- bufWriter
+		binary.Write(&bufWriter, binary.LittleEndian, samples)
+		// The device can't wait for a slow reader.
+		select {
+		case s.In <- bufWriter:
+		default:
+			atomic.AddUint64(&s.overruns, 1)
+			glog.V(2).Infof("Audio input overrun, dropping %v samples", len(samples))
+		}
 	}
 
 	for {
+		// Wait for the mic to come back.
+		if down != nil {
+			select {
+			case <-s.listenStop:
+				s.stopStream(DIR_IN)
+				return
+			case <-down:
+				down = nil
+			}
+			continue
+		}
+
 		select {
 		case <-s.listenStop:
-			if err := s.streamIn.Stop(); err != nil {
-				glog.Errorf("Failed to stop input audio stream: %v", err)
-			}
+			s.stopStream(DIR_IN)
 			return
 
 		default:
@@ -123,50 +232,126 @@ func (s *Audio) listen() {
 }
 
 func (s *Audio) playback() {
-	t := time.NewTimer(900 * time.Millisecond)
-	t.Stop()
-
-	if err := s.streamOut.Start(); err != nil {
-		glog.Fatalf("Failed to start audio out: %v", err)
-	}
+	s.outDown = s.startStream(DIR_OUT)
 
 	for {
-		select {
-		// TODO:(end_detect) Sometimes this can be sent multiple times
-		// as the audio end detection logic is not great.
-		// Need a better way to detect end of playback. Workaround
-		// is to make StatusCh a buffered channel.
-		case <-t.C:
-			glog.V(3).Infof("Finished audio playback session.")
-			s.StatusCh <- PLAYBACK_DONE
+		ok, done, idle := s.mixer.mix(s.mixBuf)
+		if ok {
+			// Flushing pads the device buffer with silence, so it waits
+			// until no session is left playing.
+			s.levels.add(DIR_OUT, s.mixBuf)
+			s.writeOut(s.outConv.Convert(s.mixBuf), len(done) > 0 && idle)
+		} else if len(done) > 0 {
+			// Sessions ended after their audio was mixed; play out what the
+			// converter and device buffer still hold.
+			silence := s.mixBuf[:RESAMPLE_TAPS+1]
+			for i := range silence {
+				silence[i] = 0
+			}
+			s.writeOut(s.outConv.Convert(silence), true)
+		}
+		s.finish(done)
+		if ok {
+			select {
+			case <-s.playbackStop:
+				s.stopOut()
+				return
+			default:
+			}
+			continue
+		}
 
+		// Nothing to play; wait for more.
+		select {
 		case <-s.playbackStop:
-			if err := s.streamOut.Stop(); err != nil {
-				glog.Errorf("Failed to stop output audio stream: %v", err)
-			}
+			s.stopOut()
 			return
 
-		case out := <-s.Out:
-			t.Stop()
-			t.Reset(900 * time.Millisecond)
-			glog.V(4).Infof("Audio chunk size: %v", out.Len())
-			if err := binary.Read(&out, binary.LittleEndian, s.bufOut); err != nil {
-				glog.Warningf("Failed to convert to binary %v", err)
-				continue
-			}
-			if err := s.streamOut.Write(); err != nil {
-				glog.Warningf("Failed to write to audio out: %v", err)
-			}
+		case <-s.mixer.wake:
+		}
+	}
+}
 
+// finish completes sessions once the device has played out their last frame.
+func (s *Audio) finish(sessions []*Session) {
+	if len(sessions) == 0 {
+		return
+	}
+	time.AfterFunc(s.latency(), func() {
+		for _, sess := range sessions {
+			glog.V(3).Infof("Finished audio playback session %v.", sess.ID)
+			sess.finish()
+		}
+	})
+}
+
+func (s *Audio) stopOut() {
+	s.stopStream(DIR_OUT)
+}
+
+// writeOut plays converted samples a device buffer at a time. Samples that
+// do not fill a buffer wait for the next call unless flush is set. While the
+// output is down the samples of a mixed frame are dropped at the rate they
+// would play, so sessions still finish.
+func (s *Audio) writeOut(samples []int16, flush bool) {
+	if s.outDown != nil {
+		select {
+		case <-s.outDown:
+			s.outDown = nil
+		default:
+			s.outPending = s.outPending[:0]
+			time.Sleep(bufDuration(OUT_FRAMES))
+			return
+		}
+	}
+
+	s.outPending = append(s.outPending, samples...)
+	for len(s.outPending) >= len(s.bufOut) || (flush && len(s.outPending) > 0) {
+		n := copy(s.bufOut, s.outPending)
+		for i := n; i < len(s.bufOut); i++ {
+			s.bufOut[i] = 0
+		}
+		s.outPending = s.outPending[n:]
+		if err := s.write(); err != nil {
+			s.outDown = s.fail(DIR_OUT, err)
+			s.outPending = s.outPending[:0]
+			return
 		}
 	}
 }
 
-func (s *Audio) Quit() {
-	if err := s.streamOut.Close(); err != nil {
-		glog.Errorf("Failed to close output audio stream: %v", err)
+// PlayClip queues the sound file fname (see DecodeClip) on mixer channel ch
+// and returns its playback session. Decoded clips are cached.
+func (s *Audio) PlayClip(fname string, ch string) (*Session, error) {
+	samples, err := s.clips.Load(fname)
+	if err != nil {
+		return nil, err
 	}
-	if err := s.streamIn.Close(); err != nil {
-		glog.Errorf("Failed to close input audio stream: %v", err)
+	session := s.NewSessionOn(ch)
+	go func() {
+		session.PlaySamples(samples)
+		session.End()
+	}()
+	return session, nil
+}
+
+// SetChannel adds mixer channel c or changes its gain and priority.
+func (s *Audio) SetChannel(c Channel) {
+	s.mixer.set(c)
+}
+
+// GetChannel returns the settings of mixer channel name.
+func (s *Audio) GetChannel(name string) (Channel, bool) {
+	return s.mixer.get(name)
+}
+
+func (s *Audio) Quit() {
+	close(s.quit)
+	s.levels.close()
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+	s.closeStreams()
+	if err := s.backend.Terminate(); err != nil {
+		glog.Errorf("Failed to terminate audio backend: %v", err)
 	}
 }
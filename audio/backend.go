@@ -0,0 +1,40 @@
+package audio
+
+import "time"
+
+// Source is a capture stream. Each Read blocks until the buffer the source
+// was opened with has been filled with new samples.
+type Source interface {
+	Start() error
+	Read() error
+	Stop() error
+	Close() error
+}
+
+// Sink is a playback stream. Each Write blocks until the buffer the sink was
+// opened with has been handed to the device. Latency is how long a written
+// sample takes to reach the speaker.
+type Sink interface {
+	Start() error
+	Write() error
+	Stop() error
+	Close() error
+	Latency() time.Duration
+}
+
+// Backend opens the capture and playback streams that Audio runs on. Streams
+// carry interleaved 16 bit samples in the formats the backend reports; Audio
+// converts them from and to DEFAULT_FORMAT.
+type Backend interface {
+	Init() error
+	Formats() (in Format, out Format)
+	OpenSource(buf []int16) (Source, error)
+	OpenSink(buf []int16) (Sink, error)
+	Terminate() error
+}
+
+// bufDuration returns the time it takes to play n mono samples at SAMPLE_RATE.
+// Backends without a real device use it to pace reads like hardware would.
+func bufDuration(n int) time.Duration {
+	return time.Duration(n) * time.Second / SAMPLE_RATE
+}
@@ -0,0 +1,143 @@
+package audio
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTone returns n samples of a 440Hz tone.
+func testTone(n int) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/SAMPLE_RATE))
+	}
+	return out
+}
+
+// startAudio returns an Audio on b that is playing back, with the mic
+// samples passed through unchanged.
+func startAudio(t *testing.T, b Backend) *Audio {
+	t.Helper()
+	a := NewWithBackend(b)
+	if err := a.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	a.SetAGC(AGCConfig{})
+	a.StartPlayback()
+	return a
+}
+
+// play plays samples in a session and waits for it to finish.
+func play(t *testing.T, a *Audio, samples []int16) {
+	t.Helper()
+	session := a.NewSession()
+	session.PlaySamples(samples)
+	session.End()
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session didn't finish")
+	}
+}
+
+// capture returns the next mic buffer.
+func capture(t *testing.T, a *Audio) []int16 {
+	t.Helper()
+	select {
+	case buf := <-a.In:
+		return BytesToSamples(buf.Bytes())
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mic audio")
+	}
+	return nil
+}
+
+func checkSamples(t *testing.T, got, want []int16) {
+	t.Helper()
+	if len(got) < len(want) {
+		t.Fatalf("got %v samples, want at least %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %v is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoopbackPlayback(t *testing.T) {
+	lb := NewLoopback()
+	a := startAudio(t, lb)
+	defer a.Quit()
+	defer a.StopPlayback()
+
+	want := testTone(3 * OUT_FRAMES / 2)
+	play(t, a, want)
+	played := lb.Played()
+	checkSamples(t, played, want)
+	for i, v := range played[len(want):] {
+		if v != 0 {
+			t.Fatalf("sample %v after the session is %v, want silence", len(want)+i, v)
+		}
+	}
+}
+
+func TestLoopbackCapture(t *testing.T) {
+	lb := NewLoopback()
+	a := startAudio(t, lb)
+	defer a.Quit()
+	defer a.StopPlayback()
+
+	// Playback loops back to the mic after the fed samples.
+	fed := testTone(IN_FRAMES)
+	lb.Feed(fed)
+	played := testTone(OUT_FRAMES)
+	for i := range played {
+		played[i] /= 2
+	}
+	play(t, a, played)
+
+	a.StartListen()
+	defer a.StopListen()
+	checkSamples(t, capture(t, a), fed)
+	checkSamples(t, capture(t, a), played)
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.wav")
+	out := filepath.Join(dir, "out.wav")
+
+	want := testTone(IN_FRAMES)
+	fh, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteWAV(fh, want, DEFAULT_FORMAT); err != nil {
+		t.Fatal(err)
+	}
+	fh.Close()
+
+	a := startAudio(t, NewFileBackend(in, out))
+	a.StartListen()
+	checkSamples(t, capture(t, a), want)
+	if silence := capture(t, a); silence[0] != 0 || silence[len(silence)-1] != 0 {
+		t.Errorf("got audio after the input file ended")
+	}
+	a.StopListen()
+
+	play(t, a, want)
+	a.StopPlayback()
+	a.Quit()
+
+	played, f, err := ReadWAVFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != DEFAULT_FORMAT {
+		t.Errorf("got format %+v, want %+v", f, DEFAULT_FORMAT)
+	}
+	checkSamples(t, played, want)
+}
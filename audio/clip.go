@@ -0,0 +1,132 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+)
+
+// DecodeClip decodes a WAV, FLAC or Ogg Vorbis file, detected from its
+// header, into interleaved 16 bit samples. Anything else is taken to be
+// headerless LINEAR16 in DEFAULT_FORMAT.
+func DecodeClip(data []byte) ([]int16, Format, error) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return ReadWAV(bytes.NewReader(data))
+
+	case len(data) >= 4 && string(data[:4]) == "fLaC":
+		return decodeFLAC(bytes.NewReader(data))
+
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return decodeVorbis(bytes.NewReader(data))
+	}
+	return BytesToSamples(data), DEFAULT_FORMAT, nil
+}
+
+func decodeFLAC(r io.Reader) ([]int16, Format, error) {
+	stream, err := flac.New(r)
+	if err != nil {
+		return nil, Format{}, fmt.Errorf("failed to read flac: %v", err)
+	}
+	defer stream.Close()
+
+	f := Format{
+		Rate:     int(stream.Info.SampleRate),
+		Channels: int(stream.Info.NChannels),
+	}
+	shift := int(stream.Info.BitsPerSample) - 16
+
+	var samples []int16
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			return samples, f, nil
+		}
+		if err != nil {
+			return nil, f, fmt.Errorf("failed to decode flac: %v", err)
+		}
+		for i := 0; i < frame.Subframes[0].NSamples; i++ {
+			for _, sub := range frame.Subframes {
+				v := sub.Samples[i]
+				if shift > 0 {
+					v >>= uint(shift)
+				} else {
+					v <<= uint(-shift)
+				}
+				samples = append(samples, int16(v))
+			}
+		}
+	}
+}
+
+func decodeVorbis(r io.Reader) ([]int16, Format, error) {
+	data, format, err := oggvorbis.ReadAll(r)
+	if err != nil {
+		return nil, Format{}, fmt.Errorf("failed to decode ogg vorbis: %v", err)
+	}
+	samples := make([]int16, len(data))
+	for i, v := range data {
+		samples[i] = clip(float64(v) * 32767)
+	}
+	return samples, Format{Rate: format.SampleRate, Channels: format.Channels}, nil
+}
+
+type cachedClip struct {
+	samples []int16
+	modTime time.Time
+	size    int64
+}
+
+// ClipCache keeps decoded clips in memory, converted to DEFAULT_FORMAT. A
+// clip is decoded again only if the modification time or size of its file
+// changed.
+type ClipCache struct {
+	lock  sync.Mutex
+	clips map[string]*cachedClip
+}
+
+func NewClipCache() *ClipCache {
+	return &ClipCache{
+		clips: make(map[string]*cachedClip),
+	}
+}
+
+// Load returns the samples of clip fname in DEFAULT_FORMAT.
+func (s *ClipCache) Load(fname string) ([]int16, error) {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c, ok := s.clips[fname]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.samples, nil
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	samples, f, err := DecodeClip(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %v", fname, err)
+	}
+	samples = Convert(samples, f, DEFAULT_FORMAT)
+	glog.V(2).Infof("Loaded clip %v (%+v, %v samples)", fname, f, len(samples))
+
+	s.clips[fname] = &cachedClip{
+		samples: samples,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	return samples, nil
+}
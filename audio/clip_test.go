@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readClip(t *testing.T, fname string) ([]int16, Format) {
+	t.Helper()
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, f, err := DecodeClip(data)
+	if err != nil {
+		t.Fatalf("DecodeClip(%v): %v", fname, err)
+	}
+	return samples, f
+}
+
+func TestDecodeClip(t *testing.T) {
+	want, wantFormat := readClip(t, "testdata/tone.wav")
+	if wantFormat != (Format{Rate: 22050, Channels: 2}) || len(want) == 0 {
+		t.Fatalf("got %v samples of %+v from the WAV clip", len(want), wantFormat)
+	}
+	for _, fname := range []string{"testdata/tone.flac", "testdata/tone24.flac"} {
+		got, f := readClip(t, fname)
+		if f != wantFormat || len(got) != len(want) {
+			t.Errorf("%v: got %v samples of %+v, want %v of %+v", fname, len(got), f, len(want), wantFormat)
+			continue
+		}
+		checkSamples(t, got, want)
+	}
+
+	// Anything else is raw LINEAR16.
+	raw := []int16{1, -2, 3}
+	got, f, err := DecodeClip(SamplesToBytes(raw))
+	if err != nil || f != DEFAULT_FORMAT || len(got) != len(raw) {
+		t.Fatalf("got %v samples of %+v (%v), want %v of %+v", len(got), f, err, len(raw), DEFAULT_FORMAT)
+	}
+	checkSamples(t, got, raw)
+}
+
+func TestDecodeClipMalformed(t *testing.T) {
+	flac, err := ioutil.ReadFile("testdata/tone.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"wav", []byte("RIFF\x04\x00\x00\x00WAVE")},
+		{"flac", []byte("fLaC\x00\x00\x00\x22garbage")},
+		{"truncated flac", flac[:len(flac)/2]},
+		{"ogg", []byte("OggS\x00garbage")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if samples, f, err := DecodeClip(c.data); err == nil {
+				t.Errorf("decoded %v samples of %+v", len(samples), f)
+			}
+		})
+	}
+}
+
+// writeClip writes samples as a DEFAULT_FORMAT WAV file with modification
+// time mtime.
+func writeClip(t *testing.T, fname string, samples []int16, mtime time.Time) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, samples, DEFAULT_FORMAT); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fname, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(fname, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClipCache(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "clip.wav")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	cache := NewClipCache()
+	load := func(want []int16) []int16 {
+		t.Helper()
+		got, err := cache.Load(fname)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %v samples, want %v", len(got), len(want))
+		}
+		checkSamples(t, got, want)
+		return got
+	}
+
+	first := []int16{1, 2, 3}
+	writeClip(t, fname, first, mtime)
+	cached := load(first)
+	if again := load(first); &again[0] != &cached[0] {
+		t.Errorf("unchanged clip decoded again")
+	}
+
+	// A new size is noticed even if the modification time is kept...
+	longer := []int16{4, 5, 6, 7}
+	writeClip(t, fname, longer, mtime)
+	load(longer)
+
+	// ...and so is a new modification time with the same size.
+	same := []int16{8, 9, 10, 11}
+	writeClip(t, fname, same, mtime.Add(time.Second))
+	load(same)
+
+	if err := os.Remove(fname); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Load(fname); err == nil {
+		t.Errorf("loaded a deleted clip")
+	}
+}
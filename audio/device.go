@@ -0,0 +1,134 @@
+package audio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// Device describes a portaudio device.
+type Device struct {
+	Index       int
+	Name        string
+	HostAPI     string
+	InChannels  int // Max input channels; 0 if not an input.
+	OutChannels int // Max output channels; 0 if not an output.
+	Rate        float64
+	InLatency   time.Duration // Default low input latency.
+	OutLatency  time.Duration // Default low output latency.
+	DefaultIn   bool
+	DefaultOut  bool
+}
+
+func (d Device) String() string {
+	def := ""
+	if d.DefaultIn {
+		def += " [default in]"
+	}
+	if d.DefaultOut {
+		def += " [default out]"
+	}
+	return fmt.Sprintf("%2d: %v (%v) in:%v out:%v rate:%v latency in:%v out:%v%v",
+		d.Index, d.Name, d.HostAPI, d.InChannels, d.OutChannels, d.Rate, d.InLatency, d.OutLatency, def)
+}
+
+// ListDevices returns the portaudio devices. It can be called before Init.
+func ListDevices() ([]Device, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+	defer portaudio.Terminate()
+
+	infos, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	defIn, _ := portaudio.DefaultInputDevice()
+	defOut, _ := portaudio.DefaultOutputDevice()
+
+	devices := make([]Device, len(infos))
+	for i, info := range infos {
+		d := Device{
+			Index:       info.Index,
+			Name:        info.Name,
+			InChannels:  info.MaxInputChannels,
+			OutChannels: info.MaxOutputChannels,
+			Rate:        info.DefaultSampleRate,
+			InLatency:   info.DefaultLowInputLatency,
+			OutLatency:  info.DefaultLowOutputLatency,
+			DefaultIn:   defIn != nil && defIn.Index == info.Index,
+			DefaultOut:  defOut != nil && defOut.Index == info.Index,
+		}
+		if info.HostApi != nil {
+			d.HostAPI = info.HostApi.Name
+		}
+		devices[i] = d
+	}
+	return devices, nil
+}
+
+// findDevice returns the input or output device named name: an index, the
+// exact name, or a unique case insensitive part of it. An empty name is the
+// default device.
+func findDevice(name string, input bool) (*portaudio.DeviceInfo, error) {
+	if name == "" {
+		if input {
+			return portaudio.DefaultInputDevice()
+		}
+		return portaudio.DefaultOutputDevice()
+	}
+
+	infos, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	return matchDevice(infos, name, input)
+}
+
+// matchDevice returns the input or output device of infos named name, as
+// findDevice does.
+func matchDevice(infos []*portaudio.DeviceInfo, name string, input bool) (*portaudio.DeviceInfo, error) {
+	dir := "output"
+	if input {
+		dir = "input"
+	}
+	var usable []*portaudio.DeviceInfo
+	for _, info := range infos {
+		if (input && info.MaxInputChannels > 0) || (!input && info.MaxOutputChannels > 0) {
+			usable = append(usable, info)
+		}
+	}
+
+	if i, err := strconv.Atoi(name); err == nil {
+		for _, info := range usable {
+			if info.Index == i {
+				return info, nil
+			}
+		}
+		return nil, fmt.Errorf("no %v audio device with index %v", dir, i)
+	}
+
+	for _, info := range usable {
+		if info.Name == name {
+			return info, nil
+		}
+	}
+	var matches []*portaudio.DeviceInfo
+	var names []string
+	for _, info := range usable {
+		if strings.Contains(strings.ToLower(info.Name), strings.ToLower(name)) {
+			matches = append(matches, info)
+			names = append(names, info.Name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no %v audio device named %q", dir, name)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%v audio device %q is ambiguous: %v", dir, name, strings.Join(names, ", "))
+}
@@ -0,0 +1,45 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+func TestMatchDevice(t *testing.T) {
+	infos := []*portaudio.DeviceInfo{
+		{Index: 0, Name: "bcm2835 Headphones", MaxOutputChannels: 8},
+		{Index: 1, Name: "USB PnP Sound Device: Audio (hw:1,0)", MaxInputChannels: 1},
+		{Index: 2, Name: "USB Audio Speaker", MaxOutputChannels: 2},
+		{Index: 3, Name: "sysdefault", MaxInputChannels: 128, MaxOutputChannels: 128},
+		{Index: 4, Name: "default", MaxInputChannels: 128, MaxOutputChannels: 128},
+	}
+	for _, c := range []struct {
+		name  string
+		input bool
+		want  int // Index; -1 for an error.
+	}{
+		{"2", false, 2},
+		{"2", true, -1}, // Not an input.
+		{"9", false, -1},
+		{"default", true, 4},  // Exact beats part of sysdefault.
+		{"DEFAULT", true, -1}, // Ambiguous.
+		{"headphones", false, 0},
+		{"headphones", true, -1},
+		{"usb", true, 1}, // Only one usb input.
+		{"usb", false, 2},
+		{"audio", false, 2},
+		{"hw:1", true, 1},
+		{"hdmi", false, -1},
+	} {
+		info, err := matchDevice(infos, c.name, c.input)
+		switch {
+		case c.want < 0 && err == nil:
+			t.Errorf("%q (input %v) matched %v, want an error", c.name, c.input, info.Name)
+		case c.want >= 0 && err != nil:
+			t.Errorf("%q (input %v): %v", c.name, c.input, err)
+		case c.want >= 0 && info.Index != c.want:
+			t.Errorf("%q (input %v) matched %v, want index %v", c.name, c.input, info.Index, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	LEVEL_INTERVAL    = 20 * time.Millisecond
+	LEVEL_WINDOW      = SAMPLE_RATE * int(LEVEL_INTERVAL/time.Millisecond) / 1000 // Samples per level.
+	LEVEL_MAX_PENDING = 50                                                        // Levels buffered per direction, 1s.
+)
+
+// Level is the loudness of one LEVEL_INTERVAL of audio, relative to full
+// scale.
+type Level struct {
+	Dir  byte // DIR_IN or DIR_OUT.
+	RMS  float64
+	Peak float64
+}
+
+// levels measures audio in both directions and publishes a Level for each
+// every LEVEL_INTERVAL. Audio is processed in bursts, so measured levels
+// queue up and are released at the real time rate; a direction with nothing
+// queued is silent. The ticker only runs while someone subscribes.
+type levels struct {
+	lock    sync.Mutex
+	partial [2][]int16 // Samples short of a window.
+	pending [2][]Level
+	subs    map[<-chan Level]chan Level // Receive side to send side.
+	stop    chan struct{}               // Closed to stop the ticker; nil while stopped.
+	quit    bool                        // Set by close; the ticker no longer starts.
+	running sync.WaitGroup              // The ticker goroutine.
+}
+
+func newLevels() *levels {
+	return &levels{
+		subs: make(map[<-chan Level]chan Level),
+	}
+}
+
+// add measures samples in DEFAULT_FORMAT played or heard in direction dir.
+func (m *levels) add(dir byte, samples []int16) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.subs) == 0 {
+		return
+	}
+
+	buf := append(m.partial[dir], samples...)
+	for len(buf) >= LEVEL_WINDOW {
+		m.pending[dir] = append(m.pending[dir], measure(dir, buf[:LEVEL_WINDOW]))
+		buf = buf[LEVEL_WINDOW:]
+	}
+	m.partial[dir] = append(m.partial[dir][:0], buf...)
+
+	// Drop the oldest if no one keeps up, so levels stay current.
+	if n := len(m.pending[dir]); n > LEVEL_MAX_PENDING {
+		m.pending[dir] = m.pending[dir][n-LEVEL_MAX_PENDING:]
+	}
+}
+
+func measure(dir byte, samples []int16) Level {
+	var sum, peak float64
+	for _, v := range samples {
+		f := float64(v) / -math.MinInt16
+		sum += f * f
+		peak = math.Max(peak, math.Abs(f))
+	}
+	return Level{
+		Dir:  dir,
+		RMS:  math.Sqrt(sum / float64(len(samples))),
+		Peak: peak,
+	}
+}
+
+func (m *levels) subscribe() <-chan Level {
+	ch := make(chan Level, 10)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.subs[ch] = ch
+	if m.stop == nil && !m.quit {
+		m.stop = make(chan struct{})
+		m.running.Add(1)
+		go m.run(m.stop)
+	}
+	return ch
+}
+
+func (m *levels) unsubscribe(ch <-chan Level) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.subs, ch)
+	if len(m.subs) == 0 {
+		m.partial = [2][]int16{}
+		m.pending = [2][]Level{}
+		m.stopTicker()
+	}
+}
+
+// close stops the ticker for good and waits for it to exit.
+func (m *levels) close() {
+	m.lock.Lock()
+	m.quit = true
+	m.stopTicker()
+	m.lock.Unlock()
+	m.running.Wait()
+}
+
+// stopTicker stops the ticker if running. It is called with the lock held.
+func (m *levels) stopTicker() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+func (m *levels) run(stop <-chan struct{}) {
+	defer m.running.Done()
+	tick := time.NewTicker(LEVEL_INTERVAL)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+
+		m.lock.Lock()
+		for dir := range m.pending {
+			l := Level{Dir: byte(dir)}
+			if len(m.pending[dir]) > 0 {
+				l = m.pending[dir][0]
+				m.pending[dir] = m.pending[dir][1:]
+			}
+			// Slow subscribers miss levels rather than stall audio.
+			for _, ch := range m.subs {
+				select {
+				case ch <- l:
+				default:
+				}
+			}
+		}
+		m.lock.Unlock()
+	}
+}
+
+// SubscribeLevels returns a channel receiving the mic and speaker Level
+// every LEVEL_INTERVAL. Call UnsubscribeLevels when done.
+func (s *Audio) SubscribeLevels() <-chan Level {
+	return s.levels.subscribe()
+}
+
+// UnsubscribeLevels stops levels to ch from SubscribeLevels.
+func (s *Audio) UnsubscribeLevels(ch <-chan Level) {
+	s.levels.unsubscribe(ch)
+}
@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+// waitStopped waits for the level ticker of m to exit.
+func waitStopped(t *testing.T, m *levels) {
+	t.Helper()
+	stopped := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("level ticker still running")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	a := NewWithBackend(NewLoopback())
+	ch := a.SubscribeLevels()
+	a.levels.add(DIR_OUT, testTone(LEVEL_WINDOW))
+
+	for l := range ch {
+		if l.Dir != DIR_OUT {
+			continue
+		}
+		if want := measure(DIR_OUT, testTone(LEVEL_WINDOW)); l != want {
+			t.Errorf("got level %+v, want %+v", l, want)
+		}
+		break
+	}
+
+	// The ticker stops with the last subscriber, and starts with the next.
+	a.UnsubscribeLevels(ch)
+	waitStopped(t, a.levels)
+	ch = a.SubscribeLevels()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no levels after subscribing again")
+	}
+
+	// And stops for good on Quit.
+	a.Quit()
+	waitStopped(t, a.levels)
+	a.SubscribeLevels()
+	waitStopped(t, a.levels)
+}
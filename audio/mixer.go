@@ -0,0 +1,367 @@
+package audio
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+const (
+	CHANNEL_SPEECH  = "speech"
+	CHANNEL_EFFECTS = "effects"
+	CHANNEL_AMBIENT = "ambient"
+
+	DUCK_GAIN = 0.25 // Gain of a channel while a higher priority one plays.
+
+	SESSION_BUFFER = 30 * SAMPLE_RATE // Samples a session can queue ahead of playback.
+)
+
+// Channel is a named mixer input.
+type Channel struct {
+	Name     string
+	Gain     float64
+	Priority int // Channels duck while a higher priority channel plays.
+}
+
+// DEFAULT_CHANNELS are the channels every Audio starts with.
+var DEFAULT_CHANNELS = []Channel{
+	{Name: CHANNEL_SPEECH, Gain: 1, Priority: 2},
+	{Name: CHANNEL_EFFECTS, Gain: 0.8, Priority: 1},
+	{Name: CHANNEL_AMBIENT, Gain: 0.5, Priority: 0},
+}
+
+type mixChannel struct {
+	Channel
+	queue []*queued // Sessions in play order.
+	duck  float64   // Ducking gain applied at the end of the last frame.
+}
+
+// queued is the audio of a session not yet mixed.
+type queued struct {
+	session *Session
+	ring    *Ring
+	ended   bool
+	started bool // Some audio was mixed.
+	starved bool // Ran out of audio mid-session.
+}
+
+// mixer sums the channels' queued audio into output frames.
+type mixer struct {
+	lock     sync.Mutex
+	channels []*mixChannel // By descending priority.
+
+	// Master volume; gain ramps to target by step per sample.
+	volume int
+	muted  bool
+	gain   float64
+	target float64
+	step   float64
+
+	wake      chan struct{} // Signalled when audio is queued or sessions end.
+	underruns uint64        // Times a playing session ran out of audio.
+	ended     []*Session    // Ended after their last audio was mixed; to flush.
+
+	// Frame buffers, reused so mixing doesn't allocate.
+	acc   []float64
+	frame []int16
+}
+
+func newMixer() *mixer {
+	m := &mixer{
+		wake:   make(chan struct{}, 1),
+		volume: DEFAULT_VOLUME,
+		gain:   volumeGain(DEFAULT_VOLUME),
+		target: volumeGain(DEFAULT_VOLUME),
+		acc:    make([]float64, OUT_FRAMES),
+		frame:  make([]int16, OUT_FRAMES),
+	}
+	for _, c := range DEFAULT_CHANNELS {
+		m.set(c)
+	}
+	return m
+}
+
+// set adds channel c or updates its gain and priority.
+func (m *mixer) set(c Channel) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ch := m.channel(c.Name); ch != nil {
+		ch.Channel = c
+	} else {
+		m.channels = append(m.channels, &mixChannel{Channel: c, duck: 1})
+	}
+	sort.SliceStable(m.channels, func(i, j int) bool {
+		return m.channels[i].Priority > m.channels[j].Priority
+	})
+}
+
+// get returns the settings of channel name.
+func (m *mixer) get(name string) (Channel, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ch := m.channel(name); ch != nil {
+		return ch.Channel, true
+	}
+	return Channel{}, false
+}
+
+func (m *mixer) channel(name string) *mixChannel {
+	for _, ch := range m.channels {
+		if ch.Name == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+// add returns the queue of session s, adding it to its channel as needed.
+// It returns nil if s was canceled.
+func (m *mixer) add(s *Session) *queued {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if s.Canceled() {
+		return nil
+	}
+
+	ch := m.channel(s.channel)
+	if ch == nil {
+		glog.Warningf("Unknown audio channel %v, adding it", s.channel)
+		ch = &mixChannel{Channel: Channel{Name: s.channel, Gain: 1}, duck: 1}
+		m.channels = append(m.channels, ch)
+	}
+	q := ch.find(s)
+	if q == nil {
+		q = &queued{session: s, ring: NewRing(SESSION_BUFFER)}
+		ch.queue = append(ch.queue, q)
+	}
+	return q
+}
+
+// write queues samples of session s, blocking while its buffer is full.
+func (m *mixer) write(s *Session, samples []int16) {
+	q := m.add(s)
+	for q != nil && len(samples) > 0 {
+		// Write a frame at a time so playback can start on a long write.
+		n := OUT_FRAMES
+		if n > len(samples) {
+			n = len(samples)
+		}
+		if q.ring.Write(samples[:n]) < n {
+			return // Canceled.
+		}
+		samples = samples[n:]
+		m.signal()
+	}
+}
+
+// end marks that session s is complete. It returns the sessions on its
+// channel that never played anything, and so are done. Sessions whose audio
+// was all mixed already are returned by the next mix, once it flushed them.
+func (m *mixer) end(s *Session) []*Session {
+	q := m.add(s)
+	if q == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	q.ended = true
+	m.signal()
+
+	var done []*Session
+	for _, q := range m.channel(s.channel).pop() {
+		if q.started {
+			m.ended = append(m.ended, q.session)
+			continue
+		}
+		done = append(done, q.session)
+	}
+	return done
+}
+
+func (m *mixer) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ch *mixChannel) find(s *Session) *queued {
+	for _, q := range ch.queue {
+		if q.session == s {
+			return q
+		}
+	}
+	return nil
+}
+
+// pop removes the sessions that ended and have nothing left to play and
+// returns them.
+func (ch *mixChannel) pop() []*queued {
+	var done []*queued
+	left := ch.queue[:0]
+	for _, q := range ch.queue {
+		if q.ended && q.ring.Len() == 0 {
+			done = append(done, q)
+			continue
+		}
+		left = append(left, q)
+	}
+	ch.queue = left
+	return done
+}
+
+// cancel drops the queued audio of session s. It returns false if s had
+// nothing queued.
+func (m *mixer) cancel(s *Session) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ch := m.channel(s.channel)
+	if ch == nil {
+		return false
+	}
+	for i, q := range ch.queue {
+		if q.session == s {
+			q.ring.Close()
+			ch.queue = append(ch.queue[:i:i], ch.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ready returns how many samples ch can contribute to a frame of n. A
+// channel in the middle of a session waits for a full frame, however the
+// audio was chunked; the tails of ended sessions ahead of it are played
+// short rather than wait for it.
+func (ch *mixChannel) ready(n int) int {
+	avail := 0
+	for _, q := range ch.queue {
+		if avail+q.ring.Len() >= n {
+			return n
+		}
+		if !q.ended {
+			break
+		}
+		avail += q.ring.Len()
+	}
+	return avail
+}
+
+// starving returns true if a session that started playing waits for audio,
+// the first time it does.
+func (ch *mixChannel) starving() bool {
+	for _, q := range ch.queue {
+		if q.started && !q.ended && !q.starved {
+			q.starved = true
+			return true
+		}
+	}
+	return false
+}
+
+// take fills out with the next samples from the queue and returns them; a
+// frame can span sessions.
+func (ch *mixChannel) take(out []int16) []int16 {
+	got := 0
+	for _, q := range ch.queue {
+		k := q.ring.Read(out[got:])
+		if k > 0 {
+			q.started = true
+			q.starved = false
+		}
+		if got += k; got == len(out) {
+			break
+		}
+	}
+	return out[:got]
+}
+
+// mix fills out with the next frame. It returns false if no channel has
+// anything to play, the sessions whose last sample is in the frame or was in
+// earlier ones, and whether no session is left playing.
+func (m *mixer) mix(out []int16) (bool, []*Session, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	done := m.ended
+	m.ended = nil
+
+	// Highest priority playing; lower ones duck under it.
+	top := math.MinInt32
+	for _, ch := range m.channels {
+		n := ch.ready(len(out))
+		if n > 0 && ch.Priority > top {
+			top = ch.Priority
+		}
+		if n == 0 && ch.starving() {
+			m.underruns++
+			glog.V(2).Infof("Audio underrun on channel %v", ch.Name)
+		}
+	}
+	if top == math.MinInt32 {
+		return false, done, m.idle()
+	}
+
+	if len(m.acc) < len(out) {
+		m.acc = make([]float64, len(out))
+		m.frame = make([]int16, len(out))
+	}
+	acc := m.acc[:len(out)]
+	for i := range acc {
+		acc[i] = 0
+	}
+	for _, ch := range m.channels {
+		target := 1.0
+		if ch.Priority < top {
+			target = DUCK_GAIN
+		}
+		n := ch.ready(len(out))
+		if n == 0 {
+			ch.duck = target
+			continue
+		}
+
+		// Ramp the ducking gain over the frame to avoid clicks.
+		for i, v := range ch.take(m.frame[:n]) {
+			duck := ch.duck + (target-ch.duck)*float64(i+1)/float64(len(out))
+			acc[i] += float64(v) * ch.Gain * duck
+		}
+		ch.duck = target
+		for _, q := range ch.pop() {
+			done = append(done, q.session)
+		}
+	}
+
+	for i, v := range acc {
+		out[i] = clip(v * m.masterGain())
+	}
+	return true, done, m.idle()
+}
+
+// idle returns true if no session is queued. Must be called with the lock
+// held.
+func (m *mixer) idle() bool {
+	for _, ch := range m.channels {
+		if len(ch.queue) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// clip rounds v to the nearest int16, saturating at the limits.
+func clip(v float64) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(math.Round(v))
+}
@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+// formatBackend is a Loopback playing in another format at about real time.
+type formatBackend struct {
+	*Loopback
+	out Format
+}
+
+func (s *formatBackend) Formats() (Format, Format) {
+	return DEFAULT_FORMAT, s.out
+}
+
+// pacedSink takes a while to play each buffer, like a device.
+type pacedSink struct {
+	Sink
+}
+
+func (s *pacedSink) Write() error {
+	time.Sleep(5 * time.Millisecond)
+	return s.Sink.Write()
+}
+
+func (s *formatBackend) OpenSink(buf []int16) (Sink, error) {
+	sink, err := s.Loopback.OpenSink(buf)
+	return &pacedSink{sink}, err
+}
+
+func waitDone(t *testing.T, s *Session) {
+	t.Helper()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("session %v didn't finish", s.ID)
+	}
+}
+
+func TestEndedSessionDoesNotWaitForNext(t *testing.T) {
+	a := startAudio(t, NewLoopback())
+	defer a.Quit()
+	defer a.StopPlayback()
+
+	first := a.NewSession()
+	first.PlaySamples(testTone(OUT_FRAMES / 4))
+	first.End()
+	// Still open, with less than a frame queued.
+	second := a.NewSession()
+	second.PlaySamples(testTone(OUT_FRAMES / 4))
+	defer second.Cancel()
+
+	waitDone(t, first)
+	select {
+	case <-second.Done():
+		t.Errorf("open session finished")
+	default:
+	}
+}
+
+func TestEndFlushesOutput(t *testing.T) {
+	out := Format{Rate: 44100, Channels: 1}
+	lb := NewLoopback()
+	a := startAudio(t, &formatBackend{Loopback: lb, out: out})
+	defer a.Quit()
+	defer a.StopPlayback()
+
+	// The session ends after all its audio was mixed, part of which doesn't
+	// fill a device buffer.
+	session := a.NewSession()
+	session.PlaySamples(testTone(2 * OUT_FRAMES))
+	time.Sleep(200 * time.Millisecond)
+	session.End()
+	waitDone(t, session)
+
+	want := 2 * OUT_FRAMES * out.Rate / SAMPLE_RATE
+	if got := len(lb.Played()); got < want {
+		t.Errorf("played %v samples when the session finished, want at least %v", got, want)
+	}
+}
+
+func TestEndDoesNotGapOtherSessions(t *testing.T) {
+	out := Format{Rate: 44100, Channels: 1}
+	lb := NewLoopback()
+	a := startAudio(t, &formatBackend{Loopback: lb, out: out})
+	defer a.Quit()
+	defer a.StopPlayback()
+
+	// A short effect ends while speech plays on.
+	speech := a.NewSession()
+	speech.PlaySamples(testTone(20 * OUT_FRAMES))
+	time.Sleep(20 * time.Millisecond)
+	effect := a.NewSessionOn(CHANNEL_EFFECTS)
+	effect.PlaySamples(testTone(OUT_FRAMES / 3))
+	effect.End()
+	waitDone(t, effect)
+	speech.End()
+	waitDone(t, speech)
+
+	played := lb.Played()
+	start, end := -1, 0
+	for i, v := range played {
+		if v != 0 {
+			if start < 0 {
+				start = i
+			}
+			end = i
+		}
+	}
+	zeros := 0
+	for i := start; i >= 0 && i <= end; i++ {
+		if zeros = zeros + 1; played[i] != 0 {
+			zeros = 0
+		}
+		if zeros > 8 {
+			t.Fatalf("silence at sample %v while speech played", i)
+		}
+	}
+}
+
+func TestMixDoesNotAllocate(t *testing.T) {
+	a := NewWithBackend(NewLoopback())
+	session := a.NewSession()
+	session.PlaySamples(testTone(SESSION_BUFFER))
+	out := make([]int16, OUT_FRAMES)
+	if n := testing.AllocsPerRun(100, func() { a.mixer.mix(out) }); n > 0 {
+		t.Errorf("mix allocates %v times per frame", n)
+	}
+}
@@ -0,0 +1,22 @@
+package audio
+
+import "encoding/binary"
+
+// BytesToSamples decodes LINEAR16 little endian audio. A trailing odd byte
+// is ignored.
+func BytesToSamples(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples
+}
+
+// SamplesToBytes encodes samples as LINEAR16 little endian audio.
+func SamplesToBytes(samples []int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	return data
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gordonklaus/portaudio"
+)
+
+// PortAudio is a Backend using portaudio input and output devices. The
+// devices, formats and latencies can be changed before Init, e.g. for devices
+// that do not support DEFAULT_FORMAT.
+type PortAudio struct {
+	InFormat   Format
+	OutFormat  Format
+	InDevice   string        // Device name or index (see ListDevices); empty for the default.
+	OutDevice  string        // Device name or index (see ListDevices); empty for the default.
+	InLatency  time.Duration // Suggested latency; 0 for the device's low latency.
+	OutLatency time.Duration // Suggested latency; 0 for the device's low latency.
+
+	inName string
+}
+
+func NewPortAudio() *PortAudio {
+	return &PortAudio{
+		InFormat:  DEFAULT_FORMAT,
+		OutFormat: DEFAULT_FORMAT,
+	}
+}
+
+func (s *PortAudio) Init() error {
+	return portaudio.Initialize()
+}
+
+func (s *PortAudio) Formats() (Format, Format) {
+	return s.InFormat, s.OutFormat
+}
+
+func (s *PortAudio) OpenSource(buf []int16) (Source, error) {
+	dev, err := findDevice(s.InDevice, true)
+	if err != nil {
+		return nil, err
+	}
+	latency := s.InLatency
+	if latency == 0 {
+		latency = dev.DefaultLowInputLatency
+	}
+	f := s.InFormat
+	glog.V(1).Infof("Opening audio input %q latency %v", dev.Name, latency)
+	s.inName = dev.Name
+
+	in, err := portaudio.OpenStream(portaudio.StreamParameters{
+		Input: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: f.Channels,
+			Latency:  latency,
+		},
+		SampleRate:      float64(f.Rate),
+		FramesPerBuffer: len(buf) / f.Channels,
+	}, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio input %q: %v", dev.Name, err)
+	}
+	return paSource{in}, nil
+}
+
+func (s *PortAudio) OpenSink(buf []int16) (Sink, error) {
+	dev, err := findDevice(s.OutDevice, false)
+	if err != nil {
+		return nil, err
+	}
+	latency := s.OutLatency
+	if latency == 0 {
+		latency = dev.DefaultLowOutputLatency
+	}
+	f := s.OutFormat
+	glog.V(1).Infof("Opening audio output %q latency %v", dev.Name, latency)
+
+	out, err := portaudio.OpenStream(portaudio.StreamParameters{
+		Output: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: f.Channels,
+			Latency:  latency,
+		},
+		SampleRate:      float64(f.Rate),
+		FramesPerBuffer: len(buf) / f.Channels,
+	}, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio output %q: %v", dev.Name, err)
+	}
+	return paSink{out}, nil
+}
+
+// InputName returns the name of the input device last opened.
+func (s *PortAudio) InputName() string {
+	return s.inName
+}
+
+func (s *PortAudio) Terminate() error {
+	return portaudio.Terminate()
+}
+
+// paSource is a portaudio input stream. Overflows lose some samples but the
+// stream carries on, so they are not errors.
+type paSource struct {
+	*portaudio.Stream
+}
+
+func (s paSource) Read() error {
+	err := s.Stream.Read()
+	if err == portaudio.InputOverflowed {
+		glog.V(2).Infof("Audio input overflowed")
+		return nil
+	}
+	return err
+}
+
+// paSink adds Latency to a portaudio output stream. Underflows are not
+// errors, like overflows of paSource.
+type paSink struct {
+	*portaudio.Stream
+}
+
+func (s paSink) Write() error {
+	err := s.Stream.Write()
+	if err == portaudio.OutputUnderflowed {
+		glog.V(2).Infof("Audio output underflowed")
+		return nil
+	}
+	return err
+}
+
+func (s paSink) Latency() time.Duration {
+	if info := s.Info(); info != nil {
+		return info.OutputLatency
+	}
+	return 0
+}
@@ -0,0 +1,290 @@
+package audio
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	DIR_IN  byte = iota // Mic.
+	DIR_OUT             // Speaker.
+)
+
+const (
+	AUDIO_FAILED byte = iota
+	AUDIO_RECOVERED
+)
+
+const (
+	RECOVER_MIN = 500 * time.Millisecond // First wait before reopening failed streams.
+	RECOVER_MAX = 30 * time.Second       // Longest wait between attempts.
+)
+
+var errNotOpen = errors.New("audio stream not open")
+
+var dirNames = map[byte]string{
+	DIR_IN:  "input",
+	DIR_OUT: "output",
+}
+
+// Event reports an audio stream failing or coming back.
+type Event struct {
+	Type byte // AUDIO_FAILED or AUDIO_RECOVERED.
+	Dir  byte // DIR_IN or DIR_OUT.
+	Err  error
+}
+
+// event publishes e on Events without blocking audio.
+func (s *Audio) event(e Event) {
+	select {
+	case s.Events <- e:
+	default:
+		glog.V(3).Infof("No one is reading audio events, dropping %+v", e)
+	}
+}
+
+// open opens the stream in direction dir. It is called with streamLock held.
+func (s *Audio) open(dir byte) error {
+	if dir == DIR_IN {
+		in, err := s.backend.OpenSource(s.bufIn)
+		if err != nil {
+			return err
+		}
+		s.streamIn = in
+		return nil
+	}
+	out, err := s.backend.OpenSink(s.bufOut)
+	if err != nil {
+		return err
+	}
+	s.streamOut = out
+	return nil
+}
+
+// closeStream closes the stream in direction dir if open. It is called with
+// streamLock held.
+func (s *Audio) closeStream(dir byte) {
+	var err error
+	switch {
+	case dir == DIR_IN && s.streamIn != nil:
+		err = s.streamIn.Close()
+		s.streamIn = nil
+	case dir == DIR_OUT && s.streamOut != nil:
+		err = s.streamOut.Close()
+		s.streamOut = nil
+	}
+	if err != nil {
+		glog.Errorf("Failed to close %v audio stream: %v", dirNames[dir], err)
+	}
+}
+
+// closeStreams closes the open streams. It is called with streamLock held.
+func (s *Audio) closeStreams() {
+	s.closeStream(DIR_OUT)
+	s.closeStream(DIR_IN)
+}
+
+// fail marks the stream in direction dir as failed and reopens the failed
+// streams in the background. It returns a channel that is closed once the
+// stream is back.
+func (s *Audio) fail(dir byte, err error) <-chan struct{} {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if !s.failed[dir] {
+		glog.Errorf("Audio %v failed: %v", dirNames[dir], err)
+		s.failed[dir] = true
+		s.recovered[dir] = make(chan struct{})
+		s.event(Event{Type: AUDIO_FAILED, Dir: dir, Err: err})
+	}
+	if !s.recovering {
+		s.recovering = true
+		go s.recover()
+	}
+	return s.recovered[dir]
+}
+
+// recover reopens the failed streams with backoff until none is left or Quit.
+func (s *Audio) recover() {
+	backoff := RECOVER_MIN
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(backoff):
+		}
+
+		err := s.reopen()
+
+		s.stateLock.Lock()
+		if !s.failed[DIR_IN] && !s.failed[DIR_OUT] {
+			s.recovering = false
+			s.stateLock.Unlock()
+			return
+		}
+		s.stateLock.Unlock()
+
+		if err == nil {
+			// Another stream failed meanwhile.
+			backoff = RECOVER_MIN
+			continue
+		}
+		if backoff *= 2; backoff > RECOVER_MAX {
+			backoff = RECOVER_MAX
+		}
+		glog.Warningf("Failed to reopen audio streams, retrying in %v: %v", backoff, err)
+	}
+}
+
+// reopen reopens the failed streams, leaving healthy ones playing. Once every
+// stream failed the backend is restarted too, so it finds devices plugged
+// back in; that would stop healthy streams.
+func (s *Audio) reopen() error {
+	s.stateLock.Lock()
+	failed := s.failed
+	s.stateLock.Unlock()
+
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+
+	for dir, f := range failed {
+		if f {
+			s.closeStream(byte(dir))
+		}
+	}
+	if failed[DIR_IN] && failed[DIR_OUT] {
+		if err := s.backend.Terminate(); err != nil {
+			glog.V(2).Infof("Failed to terminate audio backend: %v", err)
+		}
+		if err := s.backend.Init(); err != nil {
+			return err
+		}
+	}
+	for dir, f := range failed {
+		if !f {
+			continue
+		}
+		if err := s.open(byte(dir)); err != nil {
+			return err
+		}
+		if err := s.restore(byte(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore starts the reopened stream in direction dir if it was running and
+// marks it recovered. Holding stateLock, a concurrent startStream either
+// waits for recovery or finds the stream up. It is called with streamLock
+// held.
+func (s *Audio) restore(dir byte) error {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if s.running[dir] {
+		if err := s.stream(dir).Start(); err != nil {
+			return err
+		}
+	}
+	glog.Infof("Audio %v recovered", dirNames[dir])
+	s.failed[dir] = false
+	close(s.recovered[dir])
+	s.recovered[dir] = nil
+	s.event(Event{Type: AUDIO_RECOVERED, Dir: dir})
+	return nil
+}
+
+// startStream starts the stream in direction dir. If the stream is down it
+// returns a channel that is closed once it is back up and running.
+func (s *Audio) startStream(dir byte) <-chan struct{} {
+	s.stateLock.Lock()
+	s.running[dir] = true
+	recovered := s.recovered[dir]
+	s.stateLock.Unlock()
+	if recovered != nil {
+		return recovered // Started once reopened.
+	}
+
+	s.streamLock.RLock()
+	st := s.stream(dir)
+	s.streamLock.RUnlock()
+	err := errNotOpen
+	if st != nil {
+		err = st.Start()
+	}
+	if err != nil {
+		return s.fail(dir, err)
+	}
+	return nil
+}
+
+// stopStream stops the stream in direction dir.
+func (s *Audio) stopStream(dir byte) {
+	s.stateLock.Lock()
+	s.running[dir] = false
+	s.stateLock.Unlock()
+
+	s.streamLock.RLock()
+	st := s.stream(dir)
+	s.streamLock.RUnlock()
+	if st != nil {
+		if err := st.Stop(); err != nil {
+			glog.Errorf("Failed to stop %v audio stream: %v", dirNames[dir], err)
+		}
+	}
+}
+
+// stream returns the stream in direction dir, nil if not open. It is called
+// with streamLock held.
+func (s *Audio) stream(dir byte) interface {
+	Start() error
+	Stop() error
+} {
+	if dir == DIR_IN {
+		if s.streamIn == nil {
+			return nil
+		}
+		return s.streamIn
+	}
+	if s.streamOut == nil {
+		return nil
+	}
+	return s.streamOut
+}
+
+// read fills bufIn from the input stream. The lock isn't held while the
+// device blocks, so recovering the output doesn't wait for the mic.
+func (s *Audio) read() error {
+	s.streamLock.RLock()
+	in := s.streamIn
+	s.streamLock.RUnlock()
+	if in == nil {
+		return errNotOpen
+	}
+	return in.Read()
+}
+
+// write plays bufOut on the output stream. The lock isn't held while the
+// device blocks, so recovering the mic doesn't wait for playback.
+func (s *Audio) write() error {
+	s.streamLock.RLock()
+	out := s.streamOut
+	s.streamLock.RUnlock()
+	if out == nil {
+		return errNotOpen
+	}
+	return out.Write()
+}
+
+// latency returns the output latency, 0 if the stream is down.
+func (s *Audio) latency() time.Duration {
+	s.streamLock.RLock()
+	defer s.streamLock.RUnlock()
+	if s.streamOut == nil {
+		return 0
+	}
+	return s.streamOut.Latency()
+}
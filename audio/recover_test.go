@@ -0,0 +1,147 @@
+package audio
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyBackend is a Loopback whose sink fails writes while broken and fails
+// to open while unplugged, counting the streams opened and backend restarts.
+type flakyBackend struct {
+	*Loopback
+
+	lock      sync.Mutex
+	broken    bool
+	unplugged bool
+	sources   int
+	sinks     int
+	restarts  int
+}
+
+func (s *flakyBackend) Init() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.restarts++
+	return nil
+}
+
+func (s *flakyBackend) OpenSource(buf []int16) (Source, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sources++
+	return s.Loopback.OpenSource(buf)
+}
+
+func (s *flakyBackend) OpenSink(buf []int16) (Sink, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.unplugged {
+		return nil, errors.New("no speaker")
+	}
+	s.sinks++
+	sink, err := s.Loopback.OpenSink(buf)
+	return &flakySink{Sink: sink, b: s}, err
+}
+
+func (s *flakyBackend) setBroken(broken bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.broken = broken
+}
+
+func (s *flakyBackend) setUnplugged(unplugged bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.unplugged = unplugged
+}
+
+func (s *flakyBackend) counts() (sources, sinks, restarts int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sources, s.sinks, s.restarts
+}
+
+type flakySink struct {
+	Sink
+	b *flakyBackend
+}
+
+func (s *flakySink) Write() error {
+	s.b.lock.Lock()
+	broken := s.b.broken
+	s.b.lock.Unlock()
+	if broken {
+		return errors.New("speaker unplugged")
+	}
+	return s.Sink.Write()
+}
+
+func waitEvent(t *testing.T, a *Audio, want Event) {
+	t.Helper()
+	select {
+	case e := <-a.Events:
+		if e.Type != want.Type || e.Dir != want.Dir {
+			t.Fatalf("got event %+v, want %+v", e, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event %+v", want)
+	}
+}
+
+func TestRecoverOnlyFailedStream(t *testing.T) {
+	b := &flakyBackend{Loopback: NewLoopback()}
+	a := startAudio(t, b)
+	defer a.Quit()
+	defer a.StopPlayback()
+	a.StartListen()
+	defer a.StopListen()
+
+	b.setBroken(true)
+	play(t, a, testTone(OUT_FRAMES))
+	waitEvent(t, a, Event{Type: AUDIO_FAILED, Dir: DIR_OUT})
+	b.setBroken(false)
+	waitEvent(t, a, Event{Type: AUDIO_RECOVERED, Dir: DIR_OUT})
+
+	// The mic kept its stream and the backend wasn't restarted.
+	if sources, sinks, restarts := b.counts(); sources != 1 || sinks != 2 || restarts != 1 {
+		t.Errorf("opened %v sources and %v sinks with %v backend inits, want 1, 2 and 1", sources, sinks, restarts)
+	}
+
+	// Playback works again.
+	want := testTone(OUT_FRAMES)
+	before := len(b.Played())
+	play(t, a, want)
+	checkSamples(t, b.Played()[before:], want)
+}
+
+func TestListenWhileOutputDown(t *testing.T) {
+	b := &flakyBackend{Loopback: NewLoopback(), unplugged: true}
+	a := startAudio(t, b)
+	defer a.Quit()
+	defer a.StopPlayback()
+	waitEvent(t, a, Event{Type: AUDIO_FAILED, Dir: DIR_OUT})
+
+	// The healthy mic starts while the speaker is being retried.
+	want := testTone(IN_FRAMES)
+	b.Feed(want)
+	a.StartListen()
+	defer a.StopListen()
+	checkSamples(t, capture(t, a), want)
+
+	b.setUnplugged(false)
+	waitEvent(t, a, Event{Type: AUDIO_RECOVERED, Dir: DIR_OUT})
+	select {
+	case e := <-a.Events:
+		t.Errorf("got event %+v after the speaker recovered", e)
+	default:
+	}
+	if sources, _, restarts := b.counts(); sources != 1 || restarts != 1 {
+		t.Errorf("opened %v sources with %v backend inits, want 1 and 1", sources, restarts)
+	}
+
+	before := len(b.Played())
+	play(t, a, want)
+	checkSamples(t, b.Played()[before:], want)
+}
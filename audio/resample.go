@@ -0,0 +1,168 @@
+package audio
+
+import "math"
+
+const (
+	RESAMPLE_TAPS   = 16  // Filter half-width in input samples.
+	RESAMPLE_PHASES = 256 // Filter phases per input sample.
+)
+
+// Converter changes the sample rate and channel count of a stream. It keeps
+// state between calls so a stream can be converted chunk by chunk.
+type Converter struct {
+	from, to Format
+	step     float64     // Input frames per output frame.
+	kernel   [][]float64 // Filter taps by phase.
+	hist     [][]float64 // Per output channel input history.
+	pos      float64     // Position of the next output frame in hist.
+	mixed    []int16     // Remixed input; reused.
+	out      []int16     // Output; reused.
+}
+
+// NewConverter returns a Converter from format from to format to.
+func NewConverter(from, to Format) *Converter {
+	c := &Converter{
+		from: from,
+		to:   to,
+		step: float64(from.Rate) / float64(to.Rate),
+		hist: make([][]float64, to.Channels),
+		pos:  RESAMPLE_TAPS,
+	}
+	if from.Rate != to.Rate {
+		c.kernel = kernel(math.Min(1, float64(to.Rate)/float64(from.Rate)))
+	}
+	// Start with silence so the first outputs have a full filter.
+	for i := range c.hist {
+		c.hist[i] = make([]float64, RESAMPLE_TAPS)
+	}
+	return c
+}
+
+// kernel returns the taps of a Hann windowed sinc low-pass filter with
+// cutoff relative to the input Nyquist rate, for each of RESAMPLE_PHASES
+// fractional positions between input samples plus the next sample. The taps
+// of a phase sum to 1.
+func kernel(cutoff float64) [][]float64 {
+	k := make([][]float64, RESAMPLE_PHASES+1)
+	for p := range k {
+		frac := float64(p) / RESAMPLE_PHASES
+		taps := make([]float64, 2*RESAMPLE_TAPS)
+		var norm float64
+		for j := range taps {
+			d := frac + RESAMPLE_TAPS - 1 - float64(j)
+			w := 0.5 + 0.5*math.Cos(math.Pi*d/RESAMPLE_TAPS)
+			taps[j] = cutoff * sinc(cutoff*d) * w
+			norm += taps[j]
+		}
+		for j := range taps {
+			taps[j] /= norm
+		}
+		k[p] = taps
+	}
+	return k
+}
+
+// Convert converts the next interleaved samples of the stream. Output lags
+// input by RESAMPLE_TAPS input frames when the rate changes. The returned
+// samples are valid until the next call.
+func (c *Converter) Convert(in []int16) []int16 {
+	if c.from == c.to {
+		return in
+	}
+	mixed := in
+	if c.from.Channels != c.to.Channels {
+		c.mixed = remix(c.mixed, in, c.from.Channels, c.to.Channels)
+		mixed = c.mixed
+	}
+	if c.from.Rate == c.to.Rate {
+		return mixed
+	}
+
+	for i, v := range mixed {
+		ch := i % c.to.Channels
+		c.hist[ch] = append(c.hist[ch], float64(v))
+	}
+
+	// Produce every output frame whose filter window is available.
+	n := len(c.hist[0])
+	out := c.out[:0]
+	for c.pos+RESAMPLE_TAPS < float64(n) {
+		center := int(c.pos)
+		taps := c.kernel[int((c.pos-float64(center))*RESAMPLE_PHASES+0.5)]
+		for _, x := range c.hist {
+			var sum float64
+			for j, v := range x[center-RESAMPLE_TAPS+1 : center+RESAMPLE_TAPS+1] {
+				sum += v * taps[j]
+			}
+			out = append(out, clip(sum))
+		}
+		c.pos += c.step
+	}
+	c.out = out
+
+	// Drop history no longer needed by the filter.
+	if drop := int(c.pos) - RESAMPLE_TAPS; drop > 0 {
+		for ch, x := range c.hist {
+			c.hist[ch] = x[:copy(x, x[drop:])]
+		}
+		c.pos -= float64(drop)
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// remix converts interleaved samples from one channel count to another,
+// reusing out if it is big enough. Mono is spread to all channels, anything
+// is averaged down to mono, and other layouts map channels round robin.
+func remix(out []int16, in []int16, from, to int) []int16 {
+	if from == to {
+		return in
+	}
+	frames := len(in) / from
+	if cap(out) < frames*to {
+		out = make([]int16, frames*to)
+	}
+	out = out[:frames*to]
+	for f := 0; f < frames; f++ {
+		frame := in[f*from : (f+1)*from]
+		switch {
+		case to == 1:
+			sum := 0
+			for _, v := range frame {
+				sum += int(v)
+			}
+			out[f] = int16(sum / from)
+		case from == 1:
+			for ch := 0; ch < to; ch++ {
+				out[f*to+ch] = frame[0]
+			}
+		default:
+			for ch := 0; ch < to; ch++ {
+				out[f*to+ch] = frame[ch%from]
+			}
+		}
+	}
+	return out
+}
+
+// Convert converts a whole clip from format from to format to.
+func Convert(samples []int16, from, to Format) []int16 {
+	if from == to {
+		return samples
+	}
+	c := NewConverter(from, to)
+	out := append([]int16(nil), c.Convert(samples)...)
+	// Flush the filter delay with silence and trim to the expected length.
+	out = append(out, c.Convert(make([]int16, (RESAMPLE_TAPS+1)*from.Channels*2))...)
+	want := int(math.Round(float64(len(samples)/from.Channels)/c.step)) * to.Channels
+	if len(out) > want {
+		out = out[:want]
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns n frames of a 440Hz tone at rate, the same on all channels.
+func sine(n int, f Format) []int16 {
+	out := make([]int16, n*f.Channels)
+	for i := 0; i < n; i++ {
+		v := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(f.Rate)))
+		for ch := 0; ch < f.Channels; ch++ {
+			out[i*f.Channels+ch] = v
+		}
+	}
+	return out
+}
+
+func TestConvertPassthrough(t *testing.T) {
+	in := []int16{1, -2, 3, -4}
+	if out := Convert(in, DEFAULT_FORMAT, DEFAULT_FORMAT); &out[0] != &in[0] {
+		t.Errorf("same format copied")
+	}
+
+	// Channels change without filtering at the same rate.
+	stereo := Format{Rate: SAMPLE_RATE, Channels: 2}
+	out := Convert(in, DEFAULT_FORMAT, stereo)
+	checkSamples(t, out, []int16{1, 1, -2, -2, 3, 3, -4, -4})
+	out = Convert(in, stereo, DEFAULT_FORMAT)
+	if len(out) != 2 {
+		t.Fatalf("got %v samples, want 2", len(out))
+	}
+	checkSamples(t, out, []int16{0, 0})
+}
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		from, to Format
+	}{
+		{DEFAULT_FORMAT, Format{Rate: 44100, Channels: 2}},
+		{DEFAULT_FORMAT, Format{Rate: 48000, Channels: 1}},
+		{Format{Rate: 48000, Channels: 2}, DEFAULT_FORMAT},
+		{Format{Rate: 22050, Channels: 1}, DEFAULT_FORMAT},
+		{DEFAULT_FORMAT, Format{Rate: 8000, Channels: 1}},
+	} {
+		const n = 4000
+		out := Convert(sine(n, c.from), c.from, c.to)
+		want := sine(int(math.Round(n*float64(c.to.Rate)/float64(c.from.Rate))), c.to)
+		if len(out) != len(want) {
+			t.Errorf("%v to %v: got %v samples, want %v", c.from, c.to, len(out), len(want))
+			continue
+		}
+		// The tone is in the same place, once the filter has settled.
+		edge := 2 * RESAMPLE_TAPS * c.to.Rate / c.from.Rate * c.to.Channels
+		for i := edge; i < len(out)-edge; i++ {
+			if d := math.Abs(float64(out[i]) - float64(want[i])); d > 80 {
+				t.Errorf("%v to %v: sample %v is %v, want %v", c.from, c.to, i, out[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestConvertDelay(t *testing.T) {
+	// An impulse comes out at the same time, not RESAMPLE_TAPS later.
+	in := make([]int16, 1000)
+	in[500] = 16000
+	out := Convert(in, DEFAULT_FORMAT, Format{Rate: 2 * SAMPLE_RATE, Channels: 1})
+	peak := 0
+	for i, v := range out {
+		if v > out[peak] {
+			peak = i
+		}
+	}
+	if peak != 1000 {
+		t.Errorf("impulse at %v, want 1000", peak)
+	}
+}
+
+func TestConverterChunks(t *testing.T) {
+	from, to := DEFAULT_FORMAT, Format{Rate: 44100, Channels: 2}
+	in := sine(10000, from)
+	want := append([]int16(nil), NewConverter(from, to).Convert(in)...)
+
+	// The output doesn't depend on how the input is chunked.
+	c := NewConverter(from, to)
+	var got []int16
+	for i, n := 0, 1; i < len(in); i, n = i+n, n*3%797+1 {
+		if i+n > len(in) {
+			n = len(in) - i
+		}
+		got = append(got, c.Convert(in[i:i+n])...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v samples, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if d := math.Abs(float64(got[i]) - float64(want[i])); d > 8 {
+			t.Fatalf("sample %v is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestConverterDoesNotAllocate(t *testing.T) {
+	c := NewConverter(Format{Rate: 48000, Channels: 2}, DEFAULT_FORMAT)
+	in := sine(OUT_FRAMES*3, Format{Rate: 48000, Channels: 2})
+	if n := testing.AllocsPerRun(100, func() { c.Convert(in) }); n > 0 {
+		t.Errorf("Convert allocates %v times per call", n)
+	}
+}
@@ -0,0 +1,120 @@
+package audio
+
+import "sync"
+
+// Ring is a bounded FIFO of samples. Writers block while it is full, so a
+// producer can't run further ahead of playback than the ring holds. Storage
+// grows as needed up to the capacity.
+type Ring struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	buf    []int16
+	max    int
+	start  int // Index of the oldest sample in buf.
+	n      int // Samples held.
+	closed bool
+}
+
+// NewRing returns a Ring holding up to size samples.
+func NewRing(size int) *Ring {
+	r := &Ring{max: size}
+	r.cond = sync.NewCond(&r.lock)
+	return r
+}
+
+// Write appends p, waiting for room as needed. It returns the number of
+// samples written, which is short only if the ring was closed.
+func (r *Ring) Write(p []int16) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		for r.n == r.max && !r.closed {
+			r.cond.Wait()
+		}
+		if r.closed {
+			return written
+		}
+		r.grow(len(p))
+		k := r.max - r.n
+		if k > len(p) {
+			k = len(p)
+		}
+		for i, v := range p[:k] {
+			r.buf[(r.start+r.n+i)%len(r.buf)] = v
+		}
+		r.n += k
+		written += k
+		p = p[k:]
+	}
+	return written
+}
+
+// grow makes room in buf for n more samples, up to max.
+func (r *Ring) grow(n int) {
+	want := r.n + n
+	if want > r.max {
+		want = r.max
+	}
+	if want <= len(r.buf) {
+		return
+	}
+	size := 2 * len(r.buf)
+	if size < want {
+		size = want
+	}
+	if size > r.max {
+		size = r.max
+	}
+	buf := make([]int16, size)
+	r.copyOut(buf[:r.n])
+	r.buf = buf
+	r.start = 0
+}
+
+// copyOut copies the oldest len(p) samples to p without removing them.
+func (r *Ring) copyOut(p []int16) {
+	for i := range p {
+		p[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+}
+
+// Read removes up to len(p) samples into p without blocking and returns how
+// many it read.
+func (r *Ring) Read(p []int16) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	k := len(p)
+	if k > r.n {
+		k = r.n
+	}
+	r.copyOut(p[:k])
+	r.n -= k
+	if r.n == 0 {
+		r.start = 0
+	} else {
+		r.start = (r.start + k) % len(r.buf)
+	}
+	if k > 0 {
+		r.cond.Broadcast()
+	}
+	return k
+}
+
+// Len returns the number of samples held.
+func (r *Ring) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.n
+}
+
+// Close wakes blocked writers; later writes are dropped. Held samples can
+// still be read.
+func (r *Ring) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	r.cond.Broadcast()
+}
@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+var sessionID uint32
+
+// Session is one discrete playback, e.g. an assistant reply or a sound clip.
+// Its Done channel is closed exactly once, after the last sample queued
+// before End has drained from the output device. Audio is queued on a
+// bounded buffer, so Play blocks while the session is far ahead of playback.
+// A session is fed from one goroutine.
+type Session struct {
+	ID       uint32
+	channel  string
+	audio    *Audio
+	odd      []byte // Trailing byte of the last Play, not yet a whole sample.
+	fx       *Voice // Speech effect chain; nil while disabled.
+	noFx     bool   // Set by DisableVoice.
+	canceled int32  // Atomic; set by Cancel.
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewSession starts a new playback session on the speech channel.
+func (s *Audio) NewSession() *Session {
+	return s.NewSessionOn(CHANNEL_SPEECH)
+}
+
+// NewSessionOn starts a new playback session on mixer channel ch. Sessions
+// on different channels play at the same time.
+func (s *Audio) NewSessionOn(ch string) *Session {
+	return &Session{
+		ID:      atomic.AddUint32(&sessionID, 1),
+		channel: ch,
+		audio:   s,
+		done:    make(chan struct{}),
+	}
+}
+
+// Play queues LINEAR16 little endian data for playback. Data need not be
+// whole samples; a trailing odd byte is joined with the next Play.
+func (s *Session) Play(data []byte) {
+	if s.Canceled() {
+		return
+	}
+	if len(s.odd) > 0 {
+		data = append(s.odd, data...)
+		s.odd = nil
+	}
+	if len(data)%2 != 0 {
+		s.odd = []byte{data[len(data)-1]}
+		data = data[:len(data)-1]
+	}
+	s.PlaySamples(BytesToSamples(data))
+}
+
+// PlaySamples queues samples in DEFAULT_FORMAT for playback. Speech runs
+// through the voice effect chain if enabled.
+func (s *Session) PlaySamples(samples []int16) {
+	s.audio.mixer.write(s, s.voice(samples))
+}
+
+// DisableVoice keeps the voice effect chain off the session, e.g. for audio
+// rendered with it already. It must be called before playing.
+func (s *Session) DisableVoice() {
+	s.noFx = true
+}
+
+// End marks that no more data will be queued on the session.
+func (s *Session) End() {
+	if len(s.odd) > 0 {
+		glog.Warningf("Dropping odd trailing byte of audio session %v", s.ID)
+		s.odd = nil
+	}
+	if s.fx != nil && !s.Canceled() {
+		s.audio.mixer.write(s, s.fx.Flush())
+	}
+	s.audio.finish(s.audio.mixer.end(s))
+}
+
+// Done returns a channel that is closed when the session finished playing.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the session finished playing.
+func (s *Session) Wait() {
+	<-s.done
+}
+
+// Cancel stops the session. Audio not yet played is dropped, including any
+// queued later, and Done is closed right away.
+func (s *Session) Cancel() {
+	atomic.StoreInt32(&s.canceled, 1)
+	if s.audio.mixer.cancel(s) {
+		glog.V(2).Infof("Canceled audio playback session %v", s.ID)
+	}
+	s.finish()
+}
+
+// Canceled returns true if Cancel was called.
+func (s *Session) Canceled() bool {
+	return atomic.LoadInt32(&s.canceled) == 1
+}
+
+func (s *Session) finish() {
+	s.once.Do(func() { close(s.done) })
+}
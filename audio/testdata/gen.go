@@ -0,0 +1,104 @@
+//go:build ignore
+
+// gen writes the clips clip_test.go decodes: the same stereo tone as WAV and
+// as 16 and 24 bit FLAC. Run it from this folder with go run gen.go.
+package main
+
+import (
+	"math"
+	"os"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+const (
+	RATE  = 22050
+	BLOCK = 1024 // Frames per FLAC block.
+	N     = 2*BLOCK + 100
+)
+
+// tone returns N stereo frames of a 440Hz tone, quieter on the right.
+func tone() []int16 {
+	out := make([]int16, 2*N)
+	for i := 0; i < N; i++ {
+		v := 20000 * math.Sin(2*math.Pi*440*float64(i)/RATE)
+		out[2*i] = int16(v)
+		out[2*i+1] = int16(-v / 2)
+	}
+	return out
+}
+
+func writeWAV(fname string, samples []int16) {
+	fh, err := os.Create(fname)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer fh.Close()
+	if err := audio.WriteWAV(fh, samples, audio.Format{Rate: RATE, Channels: 2}); err != nil {
+		glog.Fatal(err)
+	}
+}
+
+// writeFLAC encodes samples as verbatim bits per sample FLAC.
+func writeFLAC(fname string, samples []int16, bits uint8) {
+	fh, err := os.Create(fname)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer fh.Close()
+	info := &meta.StreamInfo{
+		BlockSizeMin:  BLOCK,
+		BlockSizeMax:  BLOCK,
+		SampleRate:    RATE,
+		NChannels:     2,
+		BitsPerSample: bits,
+		NSamples:      N,
+	}
+	enc, err := flac.NewEncoder(fh, info)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	for start := 0; start < N; start += BLOCK {
+		n := BLOCK
+		if start+n > N {
+			n = N - start
+		}
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(n),
+				SampleRate:        RATE,
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     bits,
+			},
+		}
+		for ch := 0; ch < 2; ch++ {
+			sub := make([]int32, n)
+			for i := range sub {
+				sub[i] = int32(samples[2*(start+i)+ch]) << (bits - 16)
+			}
+			f.Subframes = append(f.Subframes, &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   sub,
+				NSamples:  n,
+			})
+		}
+		if err := enc.WriteFrame(f); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		glog.Fatal(err)
+	}
+}
+
+func main() {
+	samples := tone()
+	writeWAV("tone.wav", samples)
+	writeFLAC("tone.flac", samples, 16)
+	writeFLAC("tone24.flac", samples, 24)
+}
@@ -0,0 +1,175 @@
+package audio
+
+import "math"
+
+const (
+	VAD_SPEECH_START byte = iota + 1
+	VAD_SPEECH_END
+)
+
+// VADEvent is a voice activity transition. Offset is the sample index,
+// counted from the first sample the VAD processed, where speech started or
+// ended.
+type VADEvent struct {
+	Type   byte
+	Offset int64
+}
+
+// VADConfig tunes the voice activity detector.
+type VADConfig struct {
+	FrameSz      int     // Samples per analysis frame.
+	MinRMS       float64 // Frames quieter than this are never speech.
+	EnergyRatio  float64 // Speech must be this much louder than the noise floor.
+	FricativeZCR float64 // Quieter frames with a zero-crossing rate above this count as speech (s, f, sh).
+	NoiseZCR     float64 // Frames with a zero-crossing rate above this are hiss, not speech.
+	StartFrames  int     // Consecutive speech frames before speech starts.
+	EndFrames    int     // Consecutive silent frames before speech ends.
+}
+
+// DefaultVADConfig returns settings for 16kHz mic input: 20ms frames, 60ms
+// to trigger and 500ms of hangover.
+func DefaultVADConfig() VADConfig {
+	return VADConfig{
+		FrameSz:      SAMPLE_RATE / 50,
+		MinRMS:       200,
+		EnergyRatio:  3,
+		FricativeZCR: 0.3,
+		NoiseZCR:     0.6,
+		StartFrames:  3,
+		EndFrames:    25,
+	}
+}
+
+// VAD is an energy and zero-crossing voice activity detector. It tracks the
+// noise floor while nobody is talking so it adapts to the room.
+type VAD struct {
+	c        VADConfig
+	frame    []int16 // Partial frame carried over between Process calls.
+	offset   int64   // Sample index of the start of frame.
+	floor    float64 // Noise floor RMS.
+	talking  bool
+	run      int   // Length of the current run of speech or silent frames.
+	runStart int64 // Offset where the current run started.
+}
+
+func NewVAD(c VADConfig) *VAD {
+	return &VAD{
+		c:     c,
+		frame: make([]int16, 0, c.FrameSz),
+		floor: c.MinRMS / c.EnergyRatio,
+	}
+}
+
+// Talking reports whether speech is in progress.
+func (s *VAD) Talking() bool {
+	return s.talking
+}
+
+// Process runs the detector over the next samples of the stream and returns
+// the transitions found.
+func (s *VAD) Process(samples []int16) []VADEvent {
+	var evts []VADEvent
+
+	for len(samples) > 0 {
+		n := s.c.FrameSz - len(s.frame)
+		if n > len(samples) {
+			n = len(samples)
+		}
+		s.frame = append(s.frame, samples[:n]...)
+		samples = samples[n:]
+		if len(s.frame) < s.c.FrameSz {
+			break
+		}
+
+		if e, ok := s.classify(); ok {
+			evts = append(evts, e)
+		}
+		s.offset += int64(len(s.frame))
+		s.frame = s.frame[:0]
+	}
+	return evts
+}
+
+// classify classifies a full frame and updates the detector state.
+func (s *VAD) classify() (VADEvent, bool) {
+	rms, zcr := frameStats(s.frame)
+	thresh := math.Max(s.c.MinRMS, s.floor*s.c.EnergyRatio)
+	speech := zcr < s.c.NoiseZCR && (rms > thresh || (rms > thresh/2 && zcr > s.c.FricativeZCR))
+
+	if !speech && !s.talking {
+		// Rise slowly to avoid adapting to speech, fall fast after it.
+		if rms > s.floor {
+			s.floor = 0.95*s.floor + 0.05*rms
+		} else {
+			s.floor = 0.7*s.floor + 0.3*rms
+		}
+	}
+
+	// A run is a stretch of frames that disagree with the current state.
+	if speech == s.talking {
+		s.run = 0
+		return VADEvent{}, false
+	}
+	if s.run == 0 {
+		s.runStart = s.offset
+	}
+	s.run++
+
+	switch {
+	case !s.talking && s.run >= s.c.StartFrames:
+		s.talking = true
+		s.run = 0
+		return VADEvent{VAD_SPEECH_START, s.runStart}, true
+
+	case s.talking && s.run >= s.c.EndFrames:
+		s.talking = false
+		s.run = 0
+		return VADEvent{VAD_SPEECH_END, s.runStart}, true
+	}
+	return VADEvent{}, false
+}
+
+// frameStats returns the RMS level and zero-crossing rate of frame.
+func frameStats(frame []int16) (rms float64, zcr float64) {
+	var sum float64
+	crossings := 0
+	for i, v := range frame {
+		sum += float64(v) * float64(v)
+		if i > 0 && (v >= 0) != (frame[i-1] >= 0) {
+			crossings++
+		}
+	}
+	return math.Sqrt(sum / float64(len(frame))), float64(crossings) / float64(len(frame))
+}
+
+// TrimSilence returns the part of samples from the first detected speech to
+// the last, keeping pad samples of context on either side. It returns an
+// empty slice if there is no speech.
+func TrimSilence(samples []int16, c VADConfig, pad int) []int16 {
+	vad := NewVAD(c)
+	start, end := int64(-1), int64(len(samples))
+	for _, e := range vad.Process(samples) {
+		switch e.Type {
+		case VAD_SPEECH_START:
+			if start < 0 {
+				start = e.Offset
+			}
+			end = int64(len(samples))
+		case VAD_SPEECH_END:
+			end = e.Offset
+		}
+	}
+	if start < 0 {
+		return samples[:0]
+	}
+
+	start -= int64(pad)
+	if start < 0 {
+		start = 0
+	}
+	end += int64(pad)
+	if end > int64(len(samples)) {
+		end = int64(len(samples))
+	}
+	return samples[start:end]
+}
@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// signal builds test audio a stretch at a time.
+type signal struct {
+	samples []int16
+	rng     *rand.Rand
+}
+
+func newSignal() *signal {
+	return &signal{rng: rand.New(rand.NewSource(1))}
+}
+
+// quiet adds ms of faint background noise.
+func (s *signal) quiet(ms int) *signal {
+	for i := 0; i < ms*SAMPLE_RATE/1000; i++ {
+		s.samples = append(s.samples, int16(s.rng.Intn(61)-30))
+	}
+	return s
+}
+
+// voice adds ms of a loud 200Hz hum, standing in for voiced speech.
+func (s *signal) voice(ms int) *signal {
+	for i := 0; i < ms*SAMPLE_RATE/1000; i++ {
+		s.samples = append(s.samples, int16(3000*math.Sin(2*math.Pi*200*float64(len(s.samples))/SAMPLE_RATE)))
+	}
+	return s
+}
+
+// hiss adds ms of loud noise crossing zero on nearly every sample.
+func (s *signal) hiss(ms int) *signal {
+	for i := 0; i < ms*SAMPLE_RATE/1000; i++ {
+		v := int16(2000 + s.rng.Intn(500))
+		if len(s.samples)%2 == 0 {
+			v = -v
+		}
+		s.samples = append(s.samples, v)
+	}
+	return s
+}
+
+// detect returns the events of a DefaultVADConfig VAD over samples, fed in
+// chunks that don't line up with its frames.
+func detect(samples []int16) []VADEvent {
+	vad := NewVAD(DefaultVADConfig())
+	var evts []VADEvent
+	for len(samples) > 0 {
+		n := 1000
+		if n > len(samples) {
+			n = len(samples)
+		}
+		evts = append(evts, vad.Process(samples[:n])...)
+		samples = samples[n:]
+	}
+	return evts
+}
+
+func checkEvents(t *testing.T, got, want []VADEvent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got events %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %v is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestVAD(t *testing.T) {
+	ms := int64(SAMPLE_RATE / 1000)
+	for _, c := range []struct {
+		name string
+		s    *signal
+		want []VADEvent
+	}{
+		{"silence", newSignal().quiet(2000), nil},
+		{"hiss", newSignal().quiet(500).hiss(1000).quiet(500), nil},
+		// Onset needs 3 frames, so a 40ms click doesn't count.
+		{"click", newSignal().quiet(500).voice(40).quiet(500), nil},
+		{"speech", newSignal().quiet(1000).voice(1000).quiet(1000), []VADEvent{
+			{VAD_SPEECH_START, 1000 * ms},
+			{VAD_SPEECH_END, 2000 * ms},
+		}},
+		// The 500ms hangover bridges pauses between words...
+		{"pause", newSignal().quiet(1000).voice(500).quiet(300).voice(500).quiet(1000), []VADEvent{
+			{VAD_SPEECH_START, 1000 * ms},
+			{VAD_SPEECH_END, 2300 * ms},
+		}},
+		// ...so speech hasn't ended until 500ms of silence followed it.
+		{"short tail", newSignal().quiet(1000).voice(500).quiet(400), []VADEvent{
+			{VAD_SPEECH_START, 1000 * ms},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			checkEvents(t, detect(c.s.samples), c.want)
+		})
+	}
+}
+
+func TestTrimSilence(t *testing.T) {
+	const pad = 160
+	c := DefaultVADConfig()
+
+	if got := TrimSilence(newSignal().quiet(1000).samples, c, pad); len(got) != 0 {
+		t.Errorf("kept %v samples of silence", len(got))
+	}
+
+	speech := newSignal().voice(1000).samples
+	if got := TrimSilence(speech, c, pad); len(got) != len(speech) {
+		t.Errorf("kept %v samples of %v of speech", len(got), len(speech))
+	}
+
+	samples := newSignal().quiet(500).voice(1000).quiet(1000).samples
+	got := TrimSilence(samples, c, pad)
+	start, end := SAMPLE_RATE/2-pad, 3*SAMPLE_RATE/2+pad
+	if len(got) != end-start || &got[0] != &samples[start] {
+		t.Errorf("kept %v samples, want %v from %v", len(got), end-start, start)
+	}
+
+	// Speech running to the end is kept to the end.
+	samples = newSignal().quiet(500).voice(500).samples
+	if got := TrimSilence(samples, c, pad); len(got) != len(samples)-SAMPLE_RATE/2+pad {
+		t.Errorf("kept %v samples, want %v", len(got), len(samples)-SAMPLE_RATE/2+pad)
+	}
+}
@@ -0,0 +1,226 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	PITCH_WINDOW = 40 * time.Millisecond // Grain length of the pitch shifter.
+)
+
+// VoiceConfig sets up the effect chain that makes speech sound robotic. The
+// stages run in order: pitch shift, formant, ring modulation, bit crush. A
+// stage with its zero value is bypassed.
+type VoiceConfig struct {
+	Enabled     bool    `json:"enabled"`
+	Pitch       float64 `json:"pitch"`        // Pitch shift in semitones.
+	Formant     float64 `json:"formant"`      // Center of the formant boost in Hz.
+	FormantGain float64 `json:"formant_gain"` // Formant boost in dB; negative cuts.
+	FormantQ    float64 `json:"formant_q"`    // Formant width; 0 for 1.
+	RingFreq    float64 `json:"ring_freq"`    // Ring modulator frequency in Hz.
+	RingMix     float64 `json:"ring_mix"`     // Share of ring modulated signal, 0 to 1.
+	Bits        int     `json:"bits"`         // Bits kept by the crusher, 1 to 15.
+	Downsample  int     `json:"downsample"`   // Crusher holds each sample this many times.
+}
+
+// DefaultVoiceConfig returns WallE's voice; the chain is disabled.
+func DefaultVoiceConfig() VoiceConfig {
+	return VoiceConfig{
+		Pitch:       3,
+		Formant:     1800,
+		FormantGain: 6,
+		FormantQ:    1.5,
+		RingFreq:    40,
+		RingMix:     0.4,
+		Bits:        10,
+		Downsample:  2,
+	}
+}
+
+// Voice runs the effect chain over a stream of DEFAULT_FORMAT samples.
+type Voice struct {
+	c VoiceConfig
+
+	// Pitch shifter: two taps sweep a delay line half a window apart,
+	// crossfading so each tap is silent as it wraps.
+	delay  []float64
+	pos    int
+	tap    float64
+	window float64
+	ratio  float64
+
+	formant *biquad
+
+	ringPhase float64
+
+	held  float64
+	holdN int
+}
+
+// NewVoice returns a Voice applying c.
+func NewVoice(c VoiceConfig) *Voice {
+	s := &Voice{
+		c:     c,
+		ratio: math.Pow(2, c.Pitch/12),
+	}
+	s.window = math.Floor(PITCH_WINDOW.Seconds() * SAMPLE_RATE)
+	s.delay = make([]float64, int(s.window)+2)
+	if c.Formant > 0 && c.FormantGain != 0 {
+		q := c.FormantQ
+		if q <= 0 {
+			q = 1
+		}
+		s.formant = newPeaking(c.Formant, q, c.FormantGain)
+	}
+	return s
+}
+
+// Process returns samples through the chain.
+func (s *Voice) Process(samples []int16) []int16 {
+	out := make([]int16, len(samples))
+	for i, v := range samples {
+		x := float64(v) / -math.MinInt16
+		if s.c.Pitch != 0 {
+			x = s.shift(x)
+		}
+		if s.formant != nil {
+			x = s.formant.process(x)
+		}
+		if s.c.RingFreq > 0 && s.c.RingMix > 0 {
+			x = s.ring(x)
+		}
+		if s.c.Bits > 0 || s.c.Downsample > 1 {
+			x = s.crush(x)
+		}
+		out[i] = clip(x * -math.MinInt16)
+	}
+	return out
+}
+
+// Flush returns the audio still held in the chain.
+func (s *Voice) Flush() []int16 {
+	if s.c.Pitch == 0 {
+		return nil
+	}
+	return s.Process(make([]int16, int(s.window)))
+}
+
+// shift pitch shifts one sample.
+func (s *Voice) shift(x float64) float64 {
+	n := len(s.delay)
+	s.delay[s.pos] = x
+
+	var y float64
+	for _, d := range []float64{s.tap, math.Mod(s.tap+s.window/2, s.window)} {
+		g := math.Sin(math.Pi * d / s.window)
+		y += g * g * s.read(d)
+	}
+
+	s.tap += 1 - s.ratio
+	s.tap -= s.window * math.Floor(s.tap/s.window)
+	s.pos = (s.pos + 1) % n
+	return y
+}
+
+// read returns the delay line d samples back, interpolating between samples.
+func (s *Voice) read(d float64) float64 {
+	n := len(s.delay)
+	whole := int(d)
+	frac := d - float64(whole)
+	a := s.delay[(s.pos-whole+n)%n]
+	b := s.delay[(s.pos-whole-1+2*n)%n]
+	return a + (b-a)*frac
+}
+
+// ring ring modulates one sample.
+func (s *Voice) ring(x float64) float64 {
+	m := math.Sin(2 * math.Pi * s.ringPhase)
+	s.ringPhase += s.c.RingFreq / SAMPLE_RATE
+	s.ringPhase -= math.Floor(s.ringPhase)
+	return x*(1-s.c.RingMix) + x*m*s.c.RingMix
+}
+
+// crush reduces the sample rate and resolution of one sample.
+func (s *Voice) crush(x float64) float64 {
+	if s.holdN > 0 {
+		s.holdN--
+		return s.held
+	}
+	if s.c.Downsample > 1 {
+		s.holdN = s.c.Downsample - 1
+	}
+	if s.c.Bits > 0 && s.c.Bits < 16 {
+		steps := math.Pow(2, float64(s.c.Bits-1))
+		x = math.Round(x*steps) / steps
+	}
+	s.held = x
+	return x
+}
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newPeaking returns a peaking EQ boosting gain dB around freq.
+func newPeaking(freq, q, gain float64) *biquad {
+	a := math.Pow(10, gain/40)
+	w := 2 * math.Pi * freq / SAMPLE_RATE
+	alpha := math.Sin(w) / (2 * q)
+	a0 := 1 + alpha/a
+	return &biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * math.Cos(w) / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * math.Cos(w) / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// voices holds the voice settings of an Audio.
+type voices struct {
+	lock sync.Mutex
+	c    VoiceConfig
+}
+
+// SetVoice changes the speech effect chain. Sessions pick up the change with
+// the next audio they play.
+func (s *Audio) SetVoice(c VoiceConfig) {
+	s.voices.lock.Lock()
+	defer s.voices.lock.Unlock()
+	s.voices.c = c
+}
+
+// GetVoice returns the speech effect chain settings.
+func (s *Audio) GetVoice() VoiceConfig {
+	s.voices.lock.Lock()
+	defer s.voices.lock.Unlock()
+	return s.voices.c
+}
+
+// voice runs samples of a speech session through the effect chain, keeping
+// the chain state on the session.
+func (s *Session) voice(samples []int16) []int16 {
+	if s.channel != CHANNEL_SPEECH || s.noFx {
+		return samples
+	}
+	c := s.audio.GetVoice()
+	if !c.Enabled {
+		s.fx = nil
+		return samples
+	}
+	if s.fx == nil || s.fx.c != c {
+		s.fx = NewVoice(c)
+	}
+	return s.fx.Process(samples)
+}
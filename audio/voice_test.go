@@ -0,0 +1,99 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// toneAt returns n samples of a tone at freq Hz with peak amplitude.
+func toneAt(n int, freq, amplitude float64) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/SAMPLE_RATE))
+	}
+	return out
+}
+
+func same(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestVoiceStages(t *testing.T) {
+	in := toneAt(SAMPLE_RATE/4, 300, 8000)
+	for _, c := range []struct {
+		name   string
+		c      VoiceConfig
+		bypass bool
+	}{
+		{"zero", VoiceConfig{Enabled: true}, true},
+		{"pitch", VoiceConfig{Pitch: 3}, false},
+		{"formant", VoiceConfig{Formant: 300, FormantGain: 6}, false},
+		{"formant without gain", VoiceConfig{Formant: 300}, true},
+		{"ring", VoiceConfig{RingFreq: 40, RingMix: 0.5}, false},
+		{"ring without mix", VoiceConfig{RingFreq: 40}, true},
+		{"bits", VoiceConfig{Bits: 4}, false},
+		{"all bits", VoiceConfig{Bits: 16}, true},
+		{"downsample", VoiceConfig{Downsample: 2}, false},
+		{"no downsample", VoiceConfig{Downsample: 1}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := NewVoice(c.c).Process(in)
+			if len(out) != len(in) {
+				t.Fatalf("got %v samples, want %v", len(out), len(in))
+			}
+			if bypassed := same(out, in); bypassed != c.bypass {
+				t.Errorf("bypassed is %v, want %v", bypassed, c.bypass)
+			}
+		})
+	}
+}
+
+func TestVoiceFlush(t *testing.T) {
+	latency := int(PITCH_WINDOW.Seconds() * SAMPLE_RATE)
+	in := toneAt(SAMPLE_RATE/4, 300, 8000)
+
+	v := NewVoice(VoiceConfig{Pitch: -5})
+	out := v.Process(in)
+	tail := v.Flush()
+	if len(out) != len(in) || len(tail) != latency {
+		t.Fatalf("got %v and %v flushed samples, want %v and %v", len(out), len(tail), len(in), latency)
+	}
+	// The tail of the tone is still in the pitch shifter...
+	if rms, _ := frameStats(tail[:latency/4]); rms < 1000 {
+		t.Errorf("flushed audio starts at RMS %v, want the tone", rms)
+	}
+	// ...and is out after a window.
+	if more := v.Flush(); !same(more, make([]int16, latency)) {
+		t.Errorf("second flush isn't silent")
+	}
+
+	if tail := NewVoice(VoiceConfig{Bits: 8}).Flush(); len(tail) != 0 {
+		t.Errorf("flushed %v samples without a pitch shift", len(tail))
+	}
+}
+
+func TestVoiceClips(t *testing.T) {
+	// A full scale tone boosted 12dB clips rather than wrapping around.
+	in := toneAt(SAMPLE_RATE/4, 1800, 30000)
+	out := NewVoice(VoiceConfig{Formant: 1800, FormantGain: 12}).Process(in)
+	clipped := 0
+	for i := SAMPLE_RATE / 50; i < len(in); i++ {
+		if out[i] == math.MaxInt16 || out[i] == math.MinInt16 {
+			clipped++
+		}
+		if (in[i] > 20000 && out[i] <= 0) || (in[i] < -20000 && out[i] >= 0) {
+			t.Fatalf("sample %v is %v for input %v", i, out[i], in[i])
+		}
+	}
+	if clipped == 0 {
+		t.Errorf("no samples clipped")
+	}
+}
@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	DEFAULT_VOLUME = 100                   // Percent; full volume plays samples unchanged.
+	VOLUME_RAMP    = 20 * time.Millisecond // Ramp for volume steps, to avoid clicks.
+)
+
+// SetVolume sets the master volume in percent (0-100).
+func (s *Audio) SetVolume(percent int) {
+	s.Fade(percent, VOLUME_RAMP)
+}
+
+// GetVolume returns the master volume in percent.
+func (s *Audio) GetVolume() int {
+	s.mixer.lock.Lock()
+	defer s.mixer.lock.Unlock()
+	return s.mixer.volume
+}
+
+// Fade ramps the master volume to percent over d of playback.
+func (s *Audio) Fade(percent int, d time.Duration) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	s.mixer.lock.Lock()
+	defer s.mixer.lock.Unlock()
+	s.mixer.volume = percent
+	s.mixer.ramp(d)
+}
+
+// Mute silences (or restores) output without losing the volume setting.
+func (s *Audio) Mute(on bool) {
+	s.mixer.lock.Lock()
+	defer s.mixer.lock.Unlock()
+	s.mixer.muted = on
+	s.mixer.ramp(VOLUME_RAMP)
+}
+
+func (s *Audio) Muted() bool {
+	s.mixer.lock.Lock()
+	defer s.mixer.lock.Unlock()
+	return s.mixer.muted
+}
+
+// ramp starts moving the master gain to the current volume setting over d.
+// Must be called with the lock held.
+func (m *mixer) ramp(d time.Duration) {
+	m.target = 0
+	if !m.muted {
+		m.target = volumeGain(m.volume)
+	}
+	n := float64(d) / float64(time.Second) * SAMPLE_RATE
+	if n < 1 {
+		n = 1
+	}
+	m.step = math.Abs(m.target-m.gain) / n
+}
+
+// volumeGain maps percent to a gain that sounds roughly linear in loudness.
+func volumeGain(percent int) float64 {
+	v := float64(percent) / 100
+	return v * v
+}
+
+// masterGain returns the gain for the next sample, advancing any ramp.
+// Must be called with the lock held.
+func (m *mixer) masterGain() float64 {
+	switch {
+	case m.gain < m.target:
+		m.gain = math.Min(m.gain+m.step, m.target)
+	case m.gain > m.target:
+		m.gain = math.Max(m.gain-m.step, m.target)
+	}
+	return m.gain
+}
@@ -0,0 +1,237 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	WAV_HEADER_SZ  = 44
+	WAV_PCM        = 1
+	WAV_EXTENSIBLE = 0xFFFE
+)
+
+// Format describes the layout of interleaved 16 bit PCM samples.
+type Format struct {
+	Rate     int // Samples per second per channel.
+	Channels int
+}
+
+// DEFAULT_FORMAT is what the assistant, speech APIs and resources use.
+var DEFAULT_FORMAT = Format{Rate: SAMPLE_RATE, Channels: 1}
+
+// ReadWAV decodes a PCM WAV file into 16 bit interleaved samples. 8, 24
+// and 32 bit files are scaled to 16 bit. The data chunk is read up to its
+// size or the end of r, so files streamed with a placeholder size, as
+// arecord and sox write them to a pipe, are read whole.
+func ReadWAV(r io.Reader) ([]int16, Format, error) {
+	var f Format
+
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return nil, f, fmt.Errorf("failed to read wav header: %v", err)
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, f, errors.New("not a wav file")
+	}
+
+	bits := 0
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, f, fmt.Errorf("failed to find wav data chunk: %v", err)
+		}
+		// Chunks are padded to an even number of bytes.
+		sz := int64(chunk.Size) + int64(chunk.Size&1)
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			if chunk.Size < 16 {
+				return nil, f, errors.New("wav format chunk too short")
+			}
+			var fmtChunk struct {
+				AudioFormat   uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &fmtChunk); err != nil {
+				return nil, f, fmt.Errorf("failed to read wav format: %v", err)
+			}
+			read := int64(16)
+			encoding := fmtChunk.AudioFormat
+			if encoding == WAV_EXTENSIBLE {
+				// The encoding is the start of the subformat GUID.
+				if chunk.Size < 40 {
+					return nil, f, errors.New("wav format extension too short")
+				}
+				var ext struct {
+					Size        uint16
+					ValidBits   uint16
+					ChannelMask uint32
+					SubFormat   [16]byte
+				}
+				if err := binary.Read(r, binary.LittleEndian, &ext); err != nil {
+					return nil, f, fmt.Errorf("failed to read wav format: %v", err)
+				}
+				read += 24
+				encoding = binary.LittleEndian.Uint16(ext.SubFormat[:2])
+			}
+			if encoding != WAV_PCM {
+				return nil, f, fmt.Errorf("unsupported wav encoding %v", encoding)
+			}
+			if fmtChunk.Channels == 0 || fmtChunk.SampleRate == 0 {
+				return nil, f, fmt.Errorf("invalid wav format: %v channels at %vHz", fmtChunk.Channels, fmtChunk.SampleRate)
+			}
+			switch fmtChunk.BitsPerSample {
+			case 8, 16, 24, 32:
+			default:
+				return nil, f, fmt.Errorf("unsupported bits per sample %v", fmtChunk.BitsPerSample)
+			}
+			f.Rate = int(fmtChunk.SampleRate)
+			f.Channels = int(fmtChunk.Channels)
+			bits = int(fmtChunk.BitsPerSample)
+			if _, err := io.CopyN(ioutil.Discard, r, sz-read); err != nil {
+				return nil, f, err
+			}
+
+		case "data":
+			if bits == 0 {
+				return nil, f, errors.New("wav data chunk before format chunk")
+			}
+			// The size isn't trusted for allocating; a truncated file
+			// decodes up to where it ends.
+			data, err := ioutil.ReadAll(io.LimitReader(r, int64(chunk.Size)))
+			if err != nil {
+				return nil, f, fmt.Errorf("failed to read wav data: %v", err)
+			}
+			samples, err := pcmToInt16(data, bits)
+			if err != nil {
+				return nil, f, err
+			}
+			// Drop a partial frame.
+			return samples[:len(samples)/f.Channels*f.Channels], f, nil
+
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, sz); err != nil {
+				return nil, f, err
+			}
+		}
+	}
+}
+
+// ReadWAVFile decodes the WAV file fname.
+func ReadWAVFile(fname string) ([]int16, Format, error) {
+	fh, err := os.Open(fname)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	defer fh.Close()
+	return ReadWAV(fh)
+}
+
+// pcmToInt16 converts little endian signed PCM (unsigned for 8 bit) to int16.
+func pcmToInt16(data []byte, bits int) ([]int16, error) {
+	width := bits / 8
+	if width < 1 || width > 4 {
+		return nil, fmt.Errorf("unsupported bits per sample %v", bits)
+	}
+	samples := make([]int16, len(data)/width)
+	for i := range samples {
+		b := data[i*width : (i+1)*width]
+		switch width {
+		case 1:
+			samples[i] = int16(int(b[0])-128) << 8
+		case 2:
+			samples[i] = int16(binary.LittleEndian.Uint16(b))
+		case 3:
+			samples[i] = int16(uint16(b[1]) | uint16(b[2])<<8)
+		case 4:
+			samples[i] = int16(binary.LittleEndian.Uint32(b) >> 16)
+		}
+	}
+	return samples, nil
+}
+
+// wavHeader returns a 16 bit PCM WAV header for n samples of format f.
+func wavHeader(f Format, n int) []byte {
+	dataSz := uint32(n * 2)
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, dataSz+WAV_HEADER_SZ-8)
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size          uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, WAV_PCM, uint16(f.Channels), uint32(f.Rate), uint32(f.Rate * f.Channels * 2), uint16(f.Channels * 2), 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSz)
+	return buf.Bytes()
+}
+
+// WriteWAV encodes samples as a 16 bit PCM WAV file.
+func WriteWAV(w io.Writer, samples []int16, f Format) error {
+	if _, err := w.Write(wavHeader(f, len(samples))); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
+
+// WAVWriter streams samples into a WAV file. The header sizes are fixed up
+// on Close.
+type WAVWriter struct {
+	fh     *os.File
+	format Format
+	n      int
+}
+
+// CreateWAV creates (or truncates) fname for writing samples of format f.
+func CreateWAV(fname string, f Format) (*WAVWriter, error) {
+	fh, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fh.Write(wavHeader(f, 0)); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return &WAVWriter{
+		fh:     fh,
+		format: f,
+	}, nil
+}
+
+func (s *WAVWriter) Write(samples []int16) error {
+	if err := binary.Write(s.fh, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	s.n += len(samples)
+	return nil
+}
+
+func (s *WAVWriter) Close() error {
+	if _, err := s.fh.WriteAt(wavHeader(s.format, s.n), 0); err != nil {
+		s.fh.Close()
+		return err
+	}
+	return s.fh.Close()
+}
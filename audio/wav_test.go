@@ -0,0 +1,172 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// PCM_GUID_TAIL follows the encoding in a WAVE_FORMAT_EXTENSIBLE subformat.
+const PCM_GUID_TAIL = "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xAA\x00\x38\x9B\x71"
+
+// pcmFormat returns a format chunk of encoding with channels, rate and bits.
+func pcmFormat(encoding, channels uint16, rate uint32, bits uint16) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, struct {
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{encoding, channels, rate, rate * uint32(channels*bits/8), channels * bits / 8, bits})
+	return buf.Bytes()
+}
+
+// extensibleFormat returns a WAVE_FORMAT_EXTENSIBLE format chunk of
+// subformat encoding.
+func extensibleFormat(encoding, channels uint16, rate uint32, bits uint16) []byte {
+	buf := bytes.NewBuffer(pcmFormat(WAV_EXTENSIBLE, channels, rate, bits))
+	binary.Write(buf, binary.LittleEndian, struct {
+		Size        uint16
+		ValidBits   uint16
+		ChannelMask uint32
+		Encoding    uint16
+	}{22, bits, 0, encoding})
+	buf.WriteString(PCM_GUID_TAIL)
+	return buf.Bytes()
+}
+
+// rawWAV returns a WAV file with format chunk fmtChunk, if any, and a data
+// chunk of data whose header claims size bytes.
+func rawWAV(fmtChunk []byte, size uint32, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buf.WriteString("WAVE")
+	if fmtChunk != nil {
+		buf.WriteString("fmt ")
+		binary.Write(&buf, binary.LittleEndian, uint32(len(fmtChunk)))
+		buf.Write(fmtChunk)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, size)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func checkWAV(t *testing.T, wav []byte, want []int16, wantFormat Format) {
+	t.Helper()
+	got, f, err := ReadWAV(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("ReadWAV: %v", err)
+	}
+	if f != wantFormat {
+		t.Errorf("got format %+v, want %+v", f, wantFormat)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v samples, want %v", len(got), len(want))
+	}
+	checkSamples(t, got, want)
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	stereo := Format{Rate: 44100, Channels: 2}
+	want := []int16{-32768, 32767, 0, -1, 1234, -1234}
+
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, want, stereo); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != WAV_HEADER_SZ+2*len(want) {
+		t.Errorf("wrote %v bytes, want %v", buf.Len(), WAV_HEADER_SZ+2*len(want))
+	}
+	checkWAV(t, buf.Bytes(), want, stereo)
+
+	// WAVWriter fixes up the sizes on Close.
+	fname := filepath.Join(t.TempDir(), "out.wav")
+	w, err := CreateWAV(fname, stereo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(want); i += 2 {
+		if err := w.Write(want[i : i+2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, f, err := ReadWAVFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != stereo || len(got) != len(want) {
+		t.Fatalf("got %v samples of %+v, want %v of %+v", len(got), f, len(want), stereo)
+	}
+	checkSamples(t, got, want)
+}
+
+func TestReadWAVBits(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		fmtChunk []byte
+		data     []byte
+		want     []int16
+	}{
+		{"8 bit", pcmFormat(WAV_PCM, 1, 8000, 8), []byte{0, 128, 255}, []int16{-32768, 0, 32512}},
+		{"24 bit", pcmFormat(WAV_PCM, 1, 8000, 24), []byte{0xFF, 0x34, 0x12, 0, 0, 0x80}, []int16{0x1234, -32768}},
+		{"32 bit", pcmFormat(WAV_PCM, 1, 8000, 32), []byte{0xFF, 0xFF, 0x34, 0x12}, []int16{0x1234}},
+		{"extensible", extensibleFormat(WAV_PCM, 1, 8000, 16), []byte{0x34, 0x12}, []int16{0x1234}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			checkWAV(t, rawWAV(c.fmtChunk, uint32(len(c.data)), c.data), c.want, Format{Rate: 8000, Channels: 1})
+		})
+	}
+}
+
+func TestReadWAVSizes(t *testing.T) {
+	mono := pcmFormat(WAV_PCM, 1, SAMPLE_RATE, 16)
+	data := SamplesToBytes([]int16{1, 2, 3, 4})
+
+	// Streamed files carry placeholder sizes; the data runs to the end.
+	for _, size := range []uint32{0x7FFFFFFF, 0xFFFFFFFF} {
+		checkWAV(t, rawWAV(mono, size, data), []int16{1, 2, 3, 4}, DEFAULT_FORMAT)
+	}
+	// A chunk shorter than the file stops at its size.
+	checkWAV(t, rawWAV(mono, 4, data), []int16{1, 2}, DEFAULT_FORMAT)
+	// A truncated file decodes what's there, dropping a partial frame.
+	stereo := Format{Rate: SAMPLE_RATE, Channels: 2}
+	checkWAV(t, rawWAV(pcmFormat(WAV_PCM, 2, SAMPLE_RATE, 16), 100, data[:7]), []int16{1, 2}, stereo)
+}
+
+func TestReadWAVMalformed(t *testing.T) {
+	data := SamplesToBytes([]int16{1, 2})
+	var valid bytes.Buffer
+	if err := WriteWAV(&valid, []int16{1, 2}, DEFAULT_FORMAT); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		wav  []byte
+	}{
+		{"empty", nil},
+		{"not riff", append([]byte("RIFX"), valid.Bytes()[4:]...)},
+		{"truncated header", valid.Bytes()[:30]},
+		{"no format", rawWAV(nil, 4, data)},
+		{"short format", rawWAV(pcmFormat(WAV_PCM, 1, SAMPLE_RATE, 16)[:8], 4, data)},
+		{"no channels", rawWAV(pcmFormat(WAV_PCM, 0, SAMPLE_RATE, 16), 4, data)},
+		{"no rate", rawWAV(pcmFormat(WAV_PCM, 1, 0, 16), 4, data)},
+		{"12 bit", rawWAV(pcmFormat(WAV_PCM, 1, SAMPLE_RATE, 12), 4, data)},
+		{"float", rawWAV(pcmFormat(3, 1, SAMPLE_RATE, 32), 4, data)},
+		{"extensible float", rawWAV(extensibleFormat(3, 1, SAMPLE_RATE, 32), 4, data)},
+		{"short extension", rawWAV(extensibleFormat(WAV_PCM, 1, SAMPLE_RATE, 16)[:24], 4, data)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if samples, f, err := ReadWAV(bytes.NewReader(c.wav)); err == nil {
+				t.Errorf("decoded %v samples of %+v", len(samples), f)
+			}
+		})
+	}
+}
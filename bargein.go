@@ -0,0 +1,81 @@
+package walle
+
+import (
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+// Barge-in on speech. The mic has to be louder than the echo of WallE's own
+// voice, estimated from the speaker level held for a moment to cover the
+// device latency.
+const (
+	BARGE_MIN_RMS = 0.03 // Quietest mic level that can barge in.
+	BARGE_FRAMES  = 10   // Consecutive loud mic levels needed, 200ms.
+	ECHO_RATIO    = 2.0  // Mic level over the echo estimate to count as the user.
+	ECHO_DECAY    = 0.95 // Per level decay of the echo estimate.
+)
+
+// watchBargeIn listens for the user interrupting the reply until done is
+// closed. On a button press, or speech if enabled, it cancels the
+// conversation and closes barged.
+func (s *WallE) watchBargeIn(barged chan<- struct{}, done <-chan struct{}) {
+	var levels <-chan audio.Level
+	if s.bargeIn {
+		// Voice activity from before the reply is stale.
+		s.audio.DrainVoice()
+		levels = s.audio.SubscribeLevels()
+		s.audio.StartListen()
+		defer func() {
+			s.audio.StopListen()
+			s.audio.UnsubscribeLevels(levels)
+			s.audio.DrainIn()
+		}()
+	}
+
+	talking := false
+	echo := 0.0
+	loud := 0
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case evt := <-s.btnChan:
+			if evt.Name != "push" {
+				continue
+			}
+			glog.V(1).Info("Barge-in on pushbutton")
+
+		case <-s.audio.In:
+			continue
+
+		case e := <-s.audio.VoiceCh:
+			talking = e.Type == audio.VAD_SPEECH_START
+			continue
+
+		case l := <-levels:
+			if l.Dir == audio.DIR_OUT {
+				echo *= ECHO_DECAY
+				if l.RMS > echo {
+					echo = l.RMS
+				}
+				continue
+			}
+			if !talking || l.RMS < BARGE_MIN_RMS || l.RMS < echo*ECHO_RATIO {
+				loud = 0
+				continue
+			}
+			if loud++; loud < BARGE_FRAMES {
+				continue
+			}
+			glog.V(1).Infof("Barge-in on speech (mic:%.3f echo:%.3f)", l.RMS, echo)
+		}
+
+		// Signal first so the conversation failing isn't taken as an error.
+		close(barged)
+		s.gAssistant.Cancel()
+		s.clients.Cancel()
+		return
+	}
+}
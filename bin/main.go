@@ -2,13 +2,18 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	_ "net/http"
 	_ "net/http/pprof"
+	"strings"
 	"time"
 
 	"github.com/deepakkamesh/walle"
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/deepakkamesh/walle/hotword"
+	"github.com/deepakkamesh/walle/recorder"
 	"github.com/golang/glog"
 )
 
@@ -20,9 +25,74 @@ func main() {
 	btnPort := flag.String("button_pin", "40", "Pin number for push button")
 	irPort := flag.String("ir_pin", "38", "Pin number for IR")
 	enProfiler := flag.Bool("en_profile", true, "enable profiler")
+	hotwordFiles := flag.String("hotword_templates", "", "Comma seperated WAV recordings of the hotword in resources folder; empty disables the hotword")
+	hotwordThreshold := flag.Float64("hotword_threshold", 0, "Max distance for a hotword match (0 for default)")
+	volume := flag.Int("volume", walle.VOLUME, "Initial output volume percent")
+	inRate := flag.Int("audio_in_rate", 16000, "Sample rate of the mic device")
+	inChannels := flag.Int("audio_in_channels", 1, "Channels of the mic device")
+	outRate := flag.Int("audio_out_rate", 16000, "Sample rate of the speaker device")
+	outChannels := flag.Int("audio_out_channels", 1, "Channels of the speaker device")
+	inDevice := flag.String("audio_in_device", "", "Mic device name or index (see -list_audio_devices); empty for the default")
+	outDevice := flag.String("audio_out_device", "", "Speaker device name or index (see -list_audio_devices); empty for the default")
+	inLatency := flag.Duration("audio_in_latency", 0, "Suggested mic latency (0 for the device default)")
+	outLatency := flag.Duration("audio_out_latency", 0, "Suggested speaker latency (0 for the device default)")
+	audioBackend := flag.String("audio_backend", "portaudio", "Audio backend: portaudio, file (see -audio_in_file and -audio_out_file) or loopback, to run without a sound card")
+	audioInFile := flag.String("audio_in_file", "", "WAV file of mic input for the file audio backend; empty for silence")
+	audioOutFile := flag.String("audio_out_file", "", "WAV file recording playback for the file audio backend; empty to discard it")
+	listDevices := flag.Bool("list_audio_devices", false, "List audio devices and exit")
+	agcFile := flag.String("agc_file", "agc.json", "File in resources folder saving mic AGC settings per device; empty to not save")
+	agcDefaults := audio.DefaultAGCConfig()
+	agcEnabled := flag.Bool("agc", false, "Enable mic automatic gain control")
+	agcTarget := flag.Float64("agc_target", agcDefaults.Target, "AGC target RMS level relative to full scale")
+	agcMaxGain := flag.Float64("agc_max_gain", agcDefaults.MaxGain, "Most the AGC boosts quiet input")
+	agcAttack := flag.Duration("agc_attack", agcDefaults.Attack, "AGC attack time")
+	agcRelease := flag.Duration("agc_release", agcDefaults.Release, "AGC release time")
+	noiseGateEnabled := flag.Bool("noise_gate_enabled", false, "Enable the mic noise gate, with or without the AGC")
+	noiseGate := flag.Float64("noise_gate", agcDefaults.GateThreshold, "Noise gate RMS threshold relative to full scale (0 disables)")
+	voiceDefaults := audio.DefaultVoiceConfig()
+	robotVoice := flag.Bool("robot_voice", false, "Run assistant and TTS speech through the robot voice effects")
+	voicePitch := flag.Float64("voice_pitch", voiceDefaults.Pitch, "Robot voice pitch shift in semitones (0 disables)")
+	voiceFormant := flag.Float64("voice_formant", voiceDefaults.Formant, "Robot voice formant boost center in Hz (0 disables)")
+	voiceFormantGain := flag.Float64("voice_formant_gain", voiceDefaults.FormantGain, "Robot voice formant boost in dB")
+	voiceFormantQ := flag.Float64("voice_formant_q", voiceDefaults.FormantQ, "Robot voice formant boost width")
+	voiceRingFreq := flag.Float64("voice_ring_freq", voiceDefaults.RingFreq, "Robot voice ring modulator frequency in Hz (0 disables)")
+	voiceRingMix := flag.Float64("voice_ring_mix", voiceDefaults.RingMix, "Share of ring modulated robot voice, 0 to 1")
+	voiceBits := flag.Int("voice_bits", voiceDefaults.Bits, "Bits kept by the robot voice bit crusher (0 disables)")
+	voiceDownsample := flag.Int("voice_downsample", voiceDefaults.Downsample, "Robot voice crusher sample hold factor (1 disables)")
+	voiceGate := flag.Bool("voice_gate", false, "Stop streaming mic audio to the assistant when the user stops talking")
 
+	bargeIn := flag.Bool("barge_in", false, "Let the user interrupt replies by talking")
+	lipSyncWords := flag.Bool("lip_sync_words", false, "Move the mouth with the word timings of transcribed replies rather than their loudness")
+	sounds := flag.Bool("sounds", false, "Play sound effects with emotion changes")
+	recordDir := flag.String("record_dir", "", "Directory to record conversations to for debugging; empty disables recording")
+	recordSessions := flag.Int("record_max_sessions", 50, "Recorded sessions to keep (0 for no limit)")
+	recordMB := flag.Int64("record_max_mb", 200, "Megabytes of recordings to keep (0 for no limit)")
+	recordAge := flag.Duration("record_max_age", 7*24*time.Hour, "Age after which recordings are deleted (0 for no limit)")
+	ttsVoice := flag.String("tts_voice", "slt", "Flite voice for spoken phrases")
+	ttsCache := flag.String("tts_cache", "tts_cache", "Folder in resources folder caching spoken phrases; empty to not cache")
+	language := flag.String("language", "en-US", "BCP-47 code of the language of speech recognition and sentiment")
+	detectLanguages := flag.String("detect_languages", "", "Comma separated BCP-47 codes of other languages to detect replies in")
+	keywordsFile := flag.String("keywords_file", "", "JSON file in resources folder of emotion keyword tables per language; empty for the built in tables")
+	apiTimeout := flag.Duration("api_timeout", walle.API_TIMEOUT, "Limit of each cloud API call")
+	sentiment := flag.String("sentiment", walle.SENTIMENT_GOOGLE, "Sentiment analyzer: google or lexicon")
+	sentimentFallback := flag.Bool("sentiment_fallback", true, "Fall back to the lexicon when google sentiment analysis fails")
+	lexiconFile := flag.String("lexicon_file", "", "AFINN file in resources folder of English words added to the built in sentiment lexicon; empty for none")
+	recognizer := flag.String("recognizer", walle.RECOGNIZER_GOOGLE, "Speech recognizer: google, offline or fake")
+	offlineSTT := flag.String("offline_stt", "", "Offline speech recognition command, run with a WAV file, e.g. \"pocketsphinx_continuous -logfn /dev/null -infile\"; also the fallback of google. Empty disables it")
+	fakeSTT := flag.String("fake_stt", "", "Bar separated transcripts of the fake recognizer, or answered by a local fake Speech API for google; for testing offline")
 	flag.Parse()
 
+	if *listDevices {
+		devices, err := audio.ListDevices()
+		if err != nil {
+			glog.Fatalf("Failed to list audio devices: %v", err)
+		}
+		for _, d := range devices {
+			fmt.Println(d)
+		}
+		return
+	}
+
 	// Flush logs to disk.
 	logFlusher := time.NewTicker(300 * time.Millisecond)
 	go func() {
@@ -34,11 +104,85 @@ func main() {
 
 	// Build config for Walle.
 	config := &walle.WallEConfig{
-		AssistantScope: *assistantScope,
-		SecretsFile:    *secretsFile,
-		ResourcePath:   *resourcesPath,
-		BtnPort:        *btnPort,
-		IRPort:         *irPort,
+		AssistantScope:    *assistantScope,
+		SecretsFile:       *secretsFile,
+		ResourcePath:      *resourcesPath,
+		BtnPort:           *btnPort,
+		IRPort:            *irPort,
+		VoiceGate:         *voiceGate,
+		AGCFile:           *agcFile,
+		BargeIn:           *bargeIn,
+		Sounds:            *sounds,
+		LipSyncWords:      *lipSyncWords,
+		Recognizer:        *recognizer,
+		OfflineSTT:        *offlineSTT,
+		Language:          *language,
+		KeywordsFile:      *keywordsFile,
+		APITimeout:        *apiTimeout,
+		Sentiment:         *sentiment,
+		SentimentFallback: *sentimentFallback,
+		LexiconFile:       *lexiconFile,
+		TTSVoice:          *ttsVoice,
+		TTSCache:          *ttsCache,
+		Volume:            volume,
+		AudioIn:           audio.Format{Rate: *inRate, Channels: *inChannels},
+		AudioOut:          audio.Format{Rate: *outRate, Channels: *outChannels},
+		AudioInDevice:     *inDevice,
+		AudioOutDevice:    *outDevice,
+		AudioInLatency:    *inLatency,
+		AudioOutLatency:   *outLatency,
+		Voice: audio.VoiceConfig{
+			Enabled:     *robotVoice,
+			Pitch:       *voicePitch,
+			Formant:     *voiceFormant,
+			FormantGain: *voiceFormantGain,
+			FormantQ:    *voiceFormantQ,
+			RingFreq:    *voiceRingFreq,
+			RingMix:     *voiceRingMix,
+			Bits:        *voiceBits,
+			Downsample:  *voiceDownsample,
+		},
+		Hotword: hotword.Config{
+			Threshold: *hotwordThreshold,
+		},
+		Recorder: recorder.Config{
+			Dir:         *recordDir,
+			MaxSessions: *recordSessions,
+			MaxBytes:    *recordMB << 20,
+			MaxAge:      *recordAge,
+		},
+	}
+	// AGC flags override the settings saved for the mic.
+	flag.Visit(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "agc") && f.Name != "agc_file" || strings.HasPrefix(f.Name, "noise_gate") {
+			config.AGC = &audio.AGCConfig{
+				Enabled:       *agcEnabled,
+				Target:        *agcTarget,
+				MaxGain:       *agcMaxGain,
+				Attack:        *agcAttack,
+				Release:       *agcRelease,
+				GateEnabled:   *noiseGateEnabled,
+				GateThreshold: *noiseGate,
+			}
+		}
+	})
+	switch *audioBackend {
+	case "portaudio":
+	case "file":
+		config.AudioBackend = audio.NewFileBackend(*audioInFile, *audioOutFile)
+	case "loopback":
+		config.AudioBackend = audio.NewLoopback()
+	default:
+		glog.Fatalf("Unknown audio backend %v", *audioBackend)
+	}
+	if *detectLanguages != "" {
+		config.DetectLanguages = strings.Split(*detectLanguages, ",")
+	}
+	if *fakeSTT != "" {
+		config.FakeSTT = strings.Split(*fakeSTT, "|")
+	}
+	if *hotwordFiles != "" {
+		config.Hotword.Templates = strings.Split(*hotwordFiles, ",")
 	}
 
 	// Profiler.
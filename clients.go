@@ -0,0 +1,127 @@
+package walle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	language "cloud.google.com/go/language/apiv1"
+	speech "cloud.google.com/go/speech/apiv1"
+	"github.com/golang/glog"
+	"google.golang.org/api/option"
+)
+
+const (
+	API_TIMEOUT = 15 * time.Second // Default limit of each cloud API call.
+)
+
+// Clients builds the Google Cloud API clients once and shares them. Calls
+// made with its contexts time out, and are canceled by Cancel or Close.
+type Clients struct {
+	timeout    time.Duration
+	speechOpts []option.ClientOption
+
+	lock     sync.Mutex // Guards the fields below.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	speech   *speech.Client
+	language *language.Client
+	closed   bool
+}
+
+// NewClients returns Clients whose calls time out after timeout, 0 for
+// API_TIMEOUT. speechOpts select the Speech API endpoint and credentials,
+// e.g. those of a stt.FakeServer.
+func NewClients(timeout time.Duration, speechOpts ...option.ClientOption) *Clients {
+	if timeout <= 0 {
+		timeout = API_TIMEOUT
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Clients{
+		timeout:    timeout,
+		speechOpts: speechOpts,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Context returns the context of one call. Call the CancelFunc once done.
+func (s *Clients) Context() (context.Context, context.CancelFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return context.WithTimeout(s.ctx, s.timeout)
+}
+
+// StreamContext returns the context of a long running call, e.g. a stream,
+// which isn't limited by the call timeout.
+func (s *Clients) StreamContext() (context.Context, context.CancelFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return context.WithCancel(s.ctx)
+}
+
+// Cancel cancels the calls in progress. Later calls are unaffected.
+func (s *Clients) Cancel() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+// Speech returns the Speech API client.
+func (s *Clients) Speech() (*speech.Client, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, context.Canceled
+	}
+	if s.speech == nil {
+		client, err := speech.NewClient(context.Background(), s.speechOpts...)
+		if err != nil {
+			return nil, err
+		}
+		s.speech = client
+	}
+	return s.speech, nil
+}
+
+// Language returns the Natural Language API client.
+func (s *Clients) Language() (*language.Client, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, context.Canceled
+	}
+	if s.language == nil {
+		client, err := language.NewClient(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		s.language = client
+	}
+	return s.language, nil
+}
+
+// Close cancels the calls in progress and closes the clients.
+func (s *Clients) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.cancel()
+	if s.speech != nil {
+		if err := s.speech.Close(); err != nil {
+			glog.Warningf("Failed to close Speech API client: %v", err)
+		}
+	}
+	if s.language != nil {
+		if err := s.language.Close(); err != nil {
+			glog.Warningf("Failed to close Natural Language API client: %v", err)
+		}
+	}
+}
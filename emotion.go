@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/deepakkamesh/termdraw"
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/deepakkamesh/walle/sfx"
+	"github.com/deepakkamesh/walle/stt"
 	"github.com/golang/glog"
 	"gobot.io/x/gobot/platforms/raspi"
 )
@@ -24,8 +27,44 @@ const (
 	EMOTION_SMILE_MED
 	EMOTION_THINKING
 	EMOTION_SLEEPY
+	EMOTION_LISTEN
+	EMOTION_DEGRADED
 )
 
+// Speaker RMS levels at which the mouth opens half and fully when lip syncing.
+const (
+	LIP_QUIET = 0.02
+	LIP_LOUD  = 0.12
+)
+
+// EMOTION_NAMES names the emotions for logs and recordings.
+var EMOTION_NAMES = map[byte]string{
+	EMOTION_NORM:      "normal",
+	EMOTION_SPEAK:     "speak",
+	EMOTION_BLINK:     "blink",
+	EMOTION_HAPPY:     "happy",
+	EMOTION_ANGRY:     "angry",
+	EMOTION_SAD:       "sad",
+	EMOTION_PUZZLED:   "puzzled",
+	EMOTION_SMILE_MED: "smile",
+	EMOTION_THINKING:  "thinking",
+	EMOTION_SLEEPY:    "sleepy",
+	EMOTION_LISTEN:    "listen",
+	EMOTION_DEGRADED:  "degraded",
+}
+
+// EMOTION_SOUNDS are the sound effects played when WallE changes to an
+// emotion.
+var EMOTION_SOUNDS = map[byte]string{
+	EMOTION_HAPPY:     "chirp_happy",
+	EMOTION_SMILE_MED: "chirp",
+	EMOTION_SAD:       "whoa_down",
+	EMOTION_ANGRY:     "buzz",
+	EMOTION_PUZZLED:   "whoa_up",
+	EMOTION_SLEEPY:    "whir_down",
+	EMOTION_DEGRADED:  "beep_error",
+}
+
 // Face represents a struct making up the moving parts.
 type Face struct {
 	eye   []image.Image
@@ -38,6 +77,8 @@ type Emotion struct {
 	mouth        *OLED
 	termEmotions map[byte][]image.Image
 	faceEmotions map[byte]Face
+	sounds       *sfx.Player // nil for silence.
+	last         byte        // Emotion last displayed.
 }
 
 func NewEmotion() *Emotion {
@@ -106,6 +147,12 @@ func (s *Emotion) CycleEmotions() {
 	}
 }
 
+// SetSounds pairs emotion changes with EMOTION_SOUNDS played on p; nil
+// disables them.
+func (s *Emotion) SetSounds(p *sfx.Player) {
+	s.sounds = p
+}
+
 // Expression displays the requested emotion using the character ch. If the expression is
 // animated it switchesusing ms milliseconds.
 func (s *Emotion) Expression(emotion byte, ch rune, ms uint) error {
@@ -123,24 +170,90 @@ func (s *Emotion) Expression(emotion byte, ch rune, ms uint) error {
 	s.eye.Animate(face.eye, ms)
 	s.mouth.Animate(face.mouth, ms)
 
+	if name, ok := EMOTION_SOUNDS[emotion]; ok && s.sounds != nil && emotion != s.last {
+		if _, err := s.sounds.Play(name); err != nil {
+			glog.Warningf("Failed to play sound for emotion: %v", err)
+		}
+	}
+	s.last = emotion
+
 	return nil
 }
 
+// LipSync opens the mouth with the loudness of the speaker levels until done
+// is closed. The mouth is left alone until something plays.
+func (s *Emotion) LipSync(levels <-chan audio.Level, done <-chan struct{}) {
+	closed := s.faceEmotions[EMOTION_NORM].mouth
+	open := s.faceEmotions[EMOTION_SPEAK].mouth // Half, then fully open.
+	frame := -1                                 // Mouth shown; -1 before speech.
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case l := <-levels:
+			if l.Dir != audio.DIR_OUT {
+				continue
+			}
+			next := 0
+			switch {
+			case l.RMS >= LIP_LOUD && len(open) > 1:
+				next = 2
+			case l.RMS >= LIP_QUIET && len(open) > 0:
+				next = 1
+			case frame < 0:
+				continue
+			}
+			if next == frame {
+				continue
+			}
+			frame = next
+			imgs := closed
+			if next > 0 {
+				imgs = open[next-1 : next]
+			}
+			s.mouth.Animate(imgs, 100)
+		}
+	}
+}
+
+// WordSync opens the mouth for each of words, timed from start. It returns
+// after the last word or once done is closed.
+func (s *Emotion) WordSync(words []stt.Word, start time.Time, done <-chan struct{}) {
+	closed := s.faceEmotions[EMOTION_NORM].mouth
+	open := s.faceEmotions[EMOTION_SPEAK].mouth
+	if len(open) == 0 {
+		return
+	}
+
+	for _, w := range words {
+		for _, step := range []struct {
+			at   time.Duration
+			imgs []image.Image
+		}{{w.Start, open[:1]}, {w.End, closed}} {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Until(start.Add(step.at))):
+			}
+			s.mouth.Animate(step.imgs, 100)
+		}
+	}
+}
+
 func (s *Emotion) Quit() {
 	s.term.Quit()
 	s.eye.Quit()
 	s.mouth.Quit()
 }
 
-// selectEmotion allows overriding of emotions based on txt.
-func selectEmotion(score float32, txt string) byte {
+// selectEmotion allows overriding of emotions based on txt, with the keyword
+// table words of its language.
+func selectEmotion(score float32, txt string, words map[byte][]string) byte {
 
 	// Override sentiment.
-	words := map[byte][]string{
-		EMOTION_PUZZLED: {"sorry", "apologies"},
-		EMOTION_HAPPY:   {"joke", "laugh"},
-	}
-
+	txt = strings.ToLower(txt)
 	for emotion, wordList := range words {
 		for _, word := range wordList {
 			if strings.Contains(txt, word) {
@@ -239,6 +352,8 @@ func loadTermEmotions(resPath string) (map[byte][]image.Image, error) {
 		EMOTION_SMILE_MED: exSmileMed,
 		EMOTION_THINKING:  exThinking,
 		EMOTION_SLEEPY:    exSad,
+		EMOTION_LISTEN:    exBlink,
+		EMOTION_DEGRADED:  exPuzzled,
 	}, nil
 }
 
@@ -382,7 +497,6 @@ func loadFaceEmotion(resPath string) (map[byte]Face, error) {
 	_ = eyeBlink
 	_ = mouthInvSM
 	_ = eyeClosedLG
-	_ = eyeSide2Side
 	_ = eyeClosedSMDown
 	_ = eyeClosedSM
 
@@ -397,6 +511,8 @@ func loadFaceEmotion(resPath string) (map[byte]Face, error) {
 		EMOTION_SMILE_MED: Face{eye, mouthSmileSM},
 		EMOTION_THINKING:  Face{eyeUp, mouthOpenSM},
 		EMOTION_SLEEPY:    Face{eyeClosedSM, mouthOpenSM},
+		EMOTION_LISTEN:    Face{eyePupilDialated, mouth},
+		EMOTION_DEGRADED:  Face{eyeSide2Side, mouthOpenLG},
 	}, nil
 
 }
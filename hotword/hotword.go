@@ -0,0 +1,235 @@
+/* Package hotword is an offline keyword spotter.
+*
+* The hotword is defined by a few recordings of it. Incoming audio is turned
+* into MFCC features and matched against each recording with subsequence
+* dynamic time warping. Nothing leaves the device.
+ */
+package hotword
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+const (
+	DEFAULT_THRESHOLD = 0.25
+	CHECK_EVERY       = 10  // Frames between matches (100ms).
+	REFRACTORY        = 100 // Frames to ignore after a detection (1s).
+)
+
+// Config configures a Detector.
+type Config struct {
+	Templates []string // WAV recordings of the hotword.
+	Threshold float64  // Max DTW distance to accept a match; 0 uses DEFAULT_THRESHOLD.
+}
+
+type Detector struct {
+	threshold float64
+	templates [][][]float64 // Normalized feature vectors per template.
+	maxLen    int           // Frames in the longest template.
+	feat      *mfcc
+	vad       *audio.VAD
+	window    [][]float64 // Most recent feature vectors.
+	speechAt  int         // Frames since speech was last heard.
+	sinceChk  int
+	mute      int // Frames left in the refractory period.
+}
+
+// New returns a Detector for 16kHz mono audio with no templates.
+func New(threshold float64) *Detector {
+	if threshold == 0 {
+		threshold = DEFAULT_THRESHOLD
+	}
+	return &Detector{
+		threshold: threshold,
+		feat:      newMFCC(audio.SAMPLE_RATE),
+		vad:       audio.NewVAD(audio.DefaultVADConfig()),
+		speechAt:  math.MaxInt32,
+	}
+}
+
+// NewFromConfig returns a Detector enrolled with the templates in c.
+func NewFromConfig(c Config) (*Detector, error) {
+	if len(c.Templates) == 0 {
+		return nil, errors.New("no hotword templates")
+	}
+	d := New(c.Threshold)
+	for _, f := range c.Templates {
+		samples, format, err := audio.ReadWAVFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load hotword template %v: %v", f, err)
+		}
+		if err := d.Enroll(audio.Convert(samples, format, audio.DEFAULT_FORMAT)); err != nil {
+			return nil, fmt.Errorf("failed to enroll %v: %v", f, err)
+		}
+	}
+	return d, nil
+}
+
+// Enroll adds a recording of the hotword. Leading and trailing silence is
+// trimmed.
+func (s *Detector) Enroll(samples []int16) error {
+	samples = audio.TrimSilence(samples, audio.DefaultVADConfig(), audio.SAMPLE_RATE/10)
+	feats := newMFCC(audio.SAMPLE_RATE).process(samples)
+	if len(feats) < CHECK_EVERY {
+		return errors.New("no speech in template")
+	}
+	s.templates = append(s.templates, normalize(feats))
+	if len(feats) > s.maxLen {
+		s.maxLen = len(feats)
+	}
+	return nil
+}
+
+// Reset forgets all audio processed so far.
+func (s *Detector) Reset() {
+	s.feat.reset()
+	s.vad = audio.NewVAD(audio.DefaultVADConfig())
+	s.window = nil
+	s.speechAt = math.MaxInt32
+	s.sinceChk = 0
+	s.mute = 0
+}
+
+// Process feeds the next samples of the stream and reports whether the
+// hotword was heard.
+func (s *Detector) Process(samples []int16) bool {
+	s.vad.Process(samples)
+	heard := false
+
+	for _, f := range s.feat.process(samples) {
+		s.window = append(s.window, f)
+		// Keep room for a slow speaker.
+		if keep := s.maxLen * 3 / 2; len(s.window) > keep {
+			s.window = s.window[len(s.window)-keep:]
+		}
+		s.speechAt++
+		if s.vad.Talking() {
+			s.speechAt = 0
+		}
+		if s.mute > 0 {
+			s.mute--
+			continue
+		}
+
+		// Only match while someone was talking within the window.
+		s.sinceChk++
+		if s.sinceChk < CHECK_EVERY || s.speechAt > len(s.window) || len(s.window) < s.maxLen/2 {
+			continue
+		}
+		s.sinceChk = 0
+
+		win := normalize(s.window)
+		for _, t := range s.templates {
+			d := distance(t, win)
+			glog.V(4).Infof("Hotword distance %.3f", d)
+			if d < s.threshold {
+				glog.V(1).Infof("Heard hotword (distance %.3f)", d)
+				heard = true
+				s.mute = REFRACTORY
+				s.window = nil
+				break
+			}
+		}
+	}
+	return heard
+}
+
+// Scan runs a fresh detector over a whole recording and returns the sample
+// offsets at which the hotword was detected. It is meant for checking
+// templates and thresholds against WAV files.
+func (s *Detector) Scan(samples []int16) []int {
+	s.Reset()
+	defer s.Reset()
+
+	var hits []int
+	for i := 0; i < len(samples); i += HOP_SZ {
+		end := i + HOP_SZ
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if s.Process(samples[i:end]) {
+			hits = append(hits, end)
+		}
+	}
+	return hits
+}
+
+// normalize drops the energy coefficient and subtracts the mean of each
+// coefficient (cepstral mean normalization) so loudness and microphone
+// differences matter less.
+func normalize(feats [][]float64) [][]float64 {
+	mean := make([]float64, NUM_CEPS)
+	for _, f := range feats {
+		for i, v := range f {
+			mean[i] += v / float64(len(feats))
+		}
+	}
+	out := make([][]float64, len(feats))
+	for j, f := range feats {
+		n := make([]float64, NUM_CEPS-1)
+		for i := 1; i < NUM_CEPS; i++ {
+			n[i-1] = f[i] - mean[i]
+		}
+		out[j] = n
+	}
+	return out
+}
+
+// cosDist is the cosine distance between two feature vectors.
+func cosDist(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+// distance is the path-length normalized subsequence DTW cost of matching
+// all of template t to any part of win.
+func distance(t, win [][]float64) float64 {
+	type cell struct {
+		cost float64
+		n    int
+	}
+	prev := make([]cell, len(win))
+	curr := make([]cell, len(win))
+
+	// The match may start anywhere in the window.
+	for j := range win {
+		prev[j] = cell{cosDist(t[0], win[j]), 1}
+	}
+	for i := 1; i < len(t); i++ {
+		for j := range win {
+			best := prev[j]
+			if j > 0 {
+				if c := prev[j-1]; c.cost/float64(c.n) < best.cost/float64(best.n) {
+					best = c
+				}
+				if c := curr[j-1]; c.cost/float64(c.n) < best.cost/float64(best.n) {
+					best = c
+				}
+			}
+			curr[j] = cell{best.cost + cosDist(t[i], win[j]), best.n + 1}
+		}
+		prev, curr = curr, prev
+	}
+
+	// And end anywhere.
+	best := math.Inf(1)
+	for _, c := range prev {
+		if d := c.cost / float64(c.n); d < best {
+			best = d
+		}
+	}
+	return best
+}
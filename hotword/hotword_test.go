@@ -0,0 +1,59 @@
+package hotword
+
+import (
+	"testing"
+
+	"github.com/deepakkamesh/walle/audio"
+)
+
+// The recordings in testdata are synthesized by testdata/gen.go. The hotword
+// starts after a word and the silence around it, and lasts 0.72s.
+const (
+	HOTWORD_START = 27520
+	HOTWORD_END   = HOTWORD_START + 11520
+)
+
+func newTestDetector(t *testing.T) *Detector {
+	t.Helper()
+	d, err := NewFromConfig(Config{Templates: []string{"testdata/template.wav"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func readWAV(t *testing.T, fname string) []int16 {
+	t.Helper()
+	samples, f, err := audio.ReadWAVFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return audio.Convert(samples, f, audio.DEFAULT_FORMAT)
+}
+
+func TestScanPositive(t *testing.T) {
+	d := newTestDetector(t)
+	hits := d.Scan(readWAV(t, "testdata/positive.wav"))
+	if len(hits) != 1 {
+		t.Fatalf("got %v detections at %v, want 1", len(hits), hits)
+	}
+	if hits[0] < HOTWORD_START || hits[0] > HOTWORD_END+audio.SAMPLE_RATE/2 {
+		t.Errorf("detected at sample %v, want during or just after %v-%v", hits[0], HOTWORD_START, HOTWORD_END)
+	}
+}
+
+func TestScanNegative(t *testing.T) {
+	d := newTestDetector(t)
+	if hits := d.Scan(readWAV(t, "testdata/negative.wav")); len(hits) > 0 {
+		t.Errorf("got detections at %v, want none", hits)
+	}
+}
+
+func TestScanRepeatable(t *testing.T) {
+	d := newTestDetector(t)
+	samples := readWAV(t, "testdata/positive.wav")
+	first := d.Scan(samples)
+	if second := d.Scan(samples); len(first) != len(second) || len(first) > 0 && first[0] != second[0] {
+		t.Errorf("second scan detected at %v, first at %v", second, first)
+	}
+}
@@ -0,0 +1,146 @@
+package hotword
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	FRAME_SZ  = 400 // 25ms at 16kHz.
+	HOP_SZ    = 160 // 10ms at 16kHz.
+	FFT_SZ    = 512
+	NUM_MELS  = 26
+	NUM_CEPS  = 13
+	PREEMPH   = 0.97
+	MEL_LOW   = 100
+	MEL_HIGH  = 7600
+	LOG_FLOOR = 1e-10
+)
+
+// mfcc turns 16kHz samples into mel-frequency cepstral coefficients, one
+// vector per HOP_SZ samples. It keeps state between calls so audio can be
+// fed in arbitrary chunks.
+type mfcc struct {
+	window  []float64
+	filters [][]float64 // Mel filterbank over FFT_SZ/2+1 bins.
+	dct     [][]float64
+	buf     []float64 // Pre-emphasized samples not yet consumed by a frame.
+	prev    float64   // Last raw sample, for pre-emphasis across chunks.
+}
+
+func newMFCC(rate int) *mfcc {
+	m := &mfcc{
+		window: make([]float64, FRAME_SZ),
+	}
+	for i := range m.window {
+		m.window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(FRAME_SZ-1))
+	}
+
+	// Triangular filters spaced evenly on the mel scale.
+	mel := func(f float64) float64 { return 2595 * math.Log10(1+f/700) }
+	hz := func(m float64) float64 { return 700 * (math.Pow(10, m/2595) - 1) }
+	bins := make([]int, NUM_MELS+2)
+	lo, hi := mel(MEL_LOW), mel(MEL_HIGH)
+	for i := range bins {
+		f := hz(lo + (hi-lo)*float64(i)/float64(NUM_MELS+1))
+		bins[i] = int(math.Floor(float64(FFT_SZ+1) * f / float64(rate)))
+	}
+	m.filters = make([][]float64, NUM_MELS)
+	for i := range m.filters {
+		f := make([]float64, FFT_SZ/2+1)
+		for k := bins[i]; k < bins[i+1]; k++ {
+			f[k] = float64(k-bins[i]) / float64(bins[i+1]-bins[i])
+		}
+		for k := bins[i+1]; k < bins[i+2]; k++ {
+			f[k] = float64(bins[i+2]-k) / float64(bins[i+2]-bins[i+1])
+		}
+		m.filters[i] = f
+	}
+
+	m.dct = make([][]float64, NUM_CEPS)
+	for i := range m.dct {
+		m.dct[i] = make([]float64, NUM_MELS)
+		for j := range m.dct[i] {
+			m.dct[i][j] = math.Cos(math.Pi * float64(i) * (float64(j) + 0.5) / NUM_MELS)
+		}
+	}
+	return m
+}
+
+// process returns the feature vectors for all complete frames available
+// after appending samples.
+func (m *mfcc) process(samples []int16) [][]float64 {
+	for _, v := range samples {
+		x := float64(v) / 32768
+		m.buf = append(m.buf, x-PREEMPH*m.prev)
+		m.prev = x
+	}
+
+	var feats [][]float64
+	spec := make([]complex128, FFT_SZ)
+	for len(m.buf) >= FRAME_SZ {
+		for i := range spec {
+			spec[i] = 0
+		}
+		for i := 0; i < FRAME_SZ; i++ {
+			spec[i] = complex(m.buf[i]*m.window[i], 0)
+		}
+		fft(spec)
+
+		energies := make([]float64, NUM_MELS)
+		for i, f := range m.filters {
+			var e float64
+			for k, w := range f {
+				if w == 0 {
+					continue
+				}
+				p := cmplx.Abs(spec[k])
+				e += w * p * p
+			}
+			energies[i] = math.Log(math.Max(e, LOG_FLOOR))
+		}
+
+		ceps := make([]float64, NUM_CEPS)
+		for i, d := range m.dct {
+			for j, e := range energies {
+				ceps[i] += d[j] * e
+			}
+		}
+		feats = append(feats, ceps)
+		m.buf = m.buf[HOP_SZ:]
+	}
+	// Don't let the backing array grow forever.
+	m.buf = append([]float64(nil), m.buf...)
+	return feats
+}
+
+func (m *mfcc) reset() {
+	m.buf = nil
+	m.prev = 0
+}
+
+// fft is an in place radix-2 FFT; len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+//go:build ignore
+
+// gen writes the WAV files hotword_test.go uses. Words are synthesized as
+// glides between vowels: a glottal pulse train through formant resonators.
+// Run it from this folder with go run gen.go.
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+const (
+	SEGMENT = audio.SAMPLE_RATE * 18 / 100 // Samples per vowel.
+	PAUSE   = audio.SAMPLE_RATE / 2        // Silence around words.
+	NOISE   = 30                           // Peak of the background noise.
+)
+
+// vowel is a pair of formant frequencies in Hz.
+type vowel struct{ f1, f2 float64 }
+
+var (
+	EH = vowel{530, 1840}
+	EE = vowel{270, 2290}
+	AW = vowel{570, 840}
+	L  = vowel{360, 1300}
+	OO = vowel{300, 870}
+	AH = vowel{730, 1090}
+	ER = vowel{490, 1350}
+)
+
+// HOTWORD sounds a little like "hey wall-e"; OTHER is a different word.
+var (
+	HOTWORD = []vowel{EH, EE, AW, L, EE}
+	OTHER   = []vowel{OO, AH, ER, OO, AH}
+)
+
+// resonator is a two pole band pass filter.
+type resonator struct {
+	y1, y2 float64
+}
+
+func (r *resonator) process(x, freq, bw float64) float64 {
+	c := math.Exp(-math.Pi * bw / audio.SAMPLE_RATE)
+	b1 := 2 * c * math.Cos(2*math.Pi*freq/audio.SAMPLE_RATE)
+	b2 := -c * c
+	y := (1-c)*x + b1*r.y1 + b2*r.y2
+	r.y2, r.y1 = r.y1, y
+	return y
+}
+
+// word synthesizes vowels at pitch Hz, gliding between them.
+func word(vowels []vowel, pitch float64) []float64 {
+	var f1, f2 resonator
+	out := make([]float64, SEGMENT*(len(vowels)-1))
+	phase := 0.0
+	for i := range out {
+		k := i / SEGMENT
+		t := float64(i%SEGMENT) / SEGMENT
+		a, b := vowels[k], vowels[k+1]
+		phase += pitch / audio.SAMPLE_RATE
+		pulse := 0.0
+		if phase >= 1 {
+			phase--
+			pulse = 1
+		}
+		v := f1.process(pulse, a.f1+(b.f1-a.f1)*t, 80)
+		out[i] = v + f2.process(pulse, a.f2+(b.f2-a.f2)*t, 120)
+	}
+	// Fade in and out over 20ms.
+	fade := audio.SAMPLE_RATE / 50
+	for i := 0; i < fade; i++ {
+		g := float64(i) / float64(fade)
+		out[i] *= g
+		out[len(out)-1-i] *= g
+	}
+	return out
+}
+
+// recording returns words at pitch with silence around them, scaled to peak
+// and with background noise.
+func recording(words [][]vowel, pitch, peak float64, rng *rand.Rand) []int16 {
+	var speech []float64
+	speech = append(speech, make([]float64, PAUSE)...)
+	for _, w := range words {
+		speech = append(speech, word(w, pitch)...)
+		speech = append(speech, make([]float64, PAUSE)...)
+	}
+	max := 0.0
+	for _, v := range speech {
+		max = math.Max(max, math.Abs(v))
+	}
+	out := make([]int16, len(speech))
+	for i, v := range speech {
+		out[i] = int16(v/max*peak + (rng.Float64()*2-1)*NOISE)
+	}
+	return out
+}
+
+func write(fname string, samples []int16) {
+	fh, err := os.Create(fname)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer fh.Close()
+	if err := audio.WriteWAV(fh, samples, audio.DEFAULT_FORMAT); err != nil {
+		glog.Fatal(err)
+	}
+}
+
+func main() {
+	rng := rand.New(rand.NewSource(1))
+	write("template.wav", recording([][]vowel{HOTWORD}, 120, 12000, rng))
+	write("positive.wav", recording([][]vowel{OTHER, HOTWORD}, 135, 9000, rng))
+	write("negative.wav", recording([][]vowel{OTHER, OTHER}, 135, 9000, rng))
+}
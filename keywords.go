@@ -0,0 +1,79 @@
+package walle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Keywords maps a language code to words that override the sentiment, by
+// the emotion they trigger.
+type Keywords map[string]map[byte][]string
+
+// KEYWORDS are the built in keyword tables.
+var KEYWORDS = Keywords{
+	"en": {
+		EMOTION_PUZZLED: {"sorry", "apologies"},
+		EMOTION_HAPPY:   {"joke", "laugh"},
+	},
+	"es": {
+		EMOTION_PUZZLED: {"lo siento", "perdón", "disculpa"},
+		EMOTION_HAPPY:   {"chiste", "risa", "reír"},
+	},
+	"hi": {
+		EMOTION_PUZZLED: {"माफ़", "माफ", "क्षमा"},
+		EMOTION_HAPPY:   {"मज़ाक", "मजाक", "चुटकुला", "हंसी", "हँसी"},
+	},
+}
+
+// LoadKeywords returns KEYWORDS with the tables in the JSON file fname, which
+// replace built in tables of the same language. The file maps language codes
+// to emotion names to words, e.g. {"es": {"puzzled": ["lo siento"]}}.
+func LoadKeywords(fname string) (Keywords, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var tables map[string]map[string][]string
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, err
+	}
+
+	emotions := make(map[string]byte)
+	for e, name := range EMOTION_NAMES {
+		emotions[name] = e
+	}
+
+	k := make(Keywords)
+	for lang, table := range KEYWORDS {
+		k[lang] = table
+	}
+	for lang, table := range tables {
+		words := make(map[byte][]string)
+		for name, list := range table {
+			e, ok := emotions[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown emotion %v in keywords for %v", name, lang)
+			}
+			words[e] = list
+		}
+		k[strings.ToLower(lang)] = words
+	}
+	return k, nil
+}
+
+// Lookup returns the table of language code, else of its base language,
+// e.g. "es" for "es-MX", else the English table.
+func (k Keywords) Lookup(code string) map[byte][]string {
+	code = strings.ToLower(code)
+	if t, ok := k[code]; ok {
+		return t
+	}
+	if i := strings.Index(code, "-"); i > 0 {
+		if t, ok := k[code[:i]]; ok {
+			return t
+		}
+	}
+	return k["en"]
+}
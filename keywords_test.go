@@ -0,0 +1,97 @@
+package walle
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// puzzled returns the first puzzled keyword of table, "" if none.
+func puzzled(table map[byte][]string) string {
+	if len(table[EMOTION_PUZZLED]) == 0 {
+		return ""
+	}
+	return table[EMOTION_PUZZLED][0]
+}
+
+func TestKeywordsLookup(t *testing.T) {
+	k := Keywords{
+		"en":    {EMOTION_PUZZLED: {"sorry"}},
+		"pt":    {EMOTION_PUZZLED: {"desculpe"}},
+		"pt-br": {EMOTION_PUZZLED: {"foi mal"}},
+	}
+	for _, c := range []struct {
+		code, want string
+	}{
+		{"pt-BR", "foi mal"}, // Region.
+		{"PT-br", "foi mal"},
+		{"pt-PT", "desculpe"}, // Base language.
+		{"pt", "desculpe"},
+		{"fr-FR", "sorry"}, // English.
+		{"", "sorry"},
+		{"-pt", "sorry"},
+	} {
+		if got := puzzled(k.Lookup(c.code)); got != c.want {
+			t.Errorf("%q looks up %q, want %q", c.code, got, c.want)
+		}
+	}
+
+	if got := puzzled(KEYWORDS.Lookup("es-MX")); got != "lo siento" {
+		t.Errorf("es-MX looks up %q in the built in tables, want lo siento", got)
+	}
+}
+
+func writeKeywords(t *testing.T, data string) string {
+	t.Helper()
+	fname := filepath.Join(t.TempDir(), "keywords.json")
+	if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestLoadKeywords(t *testing.T) {
+	k, err := LoadKeywords(writeKeywords(t, `{
+		"es": {"puzzled": ["perdona"]},
+		"FR": {"puzzled": ["désolé"], "happy": ["blague"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		code, want string
+	}{
+		{"es-ES", "perdona"}, // Replaced.
+		{"fr-CA", "désolé"},  // Added.
+		{"en-US", "sorry"},   // Built in.
+		{"hi-IN", "माफ़"},    // Built in.
+		{"de-DE", "sorry"},   // English.
+	} {
+		if got := puzzled(k.Lookup(c.code)); got != c.want {
+			t.Errorf("%q looks up %q, want %q", c.code, got, c.want)
+		}
+	}
+	if got := k.Lookup("fr")[EMOTION_HAPPY]; len(got) != 1 || got[0] != "blague" {
+		t.Errorf("got happy keywords %q for fr, want blague", got)
+	}
+	if len(k["es"][EMOTION_HAPPY]) != 0 {
+		t.Errorf("replaced es table kept built in happy keywords %q", k["es"][EMOTION_HAPPY])
+	}
+	if got := puzzled(KEYWORDS.Lookup("es")); got != "lo siento" {
+		t.Errorf("built in es table changed to %q", got)
+	}
+}
+
+func TestLoadKeywordsErrors(t *testing.T) {
+	for _, c := range []struct {
+		name, fname string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "missing.json")},
+		{"bad json", writeKeywords(t, `{"es": ["perdona"]}`)},
+		{"unknown emotion", writeKeywords(t, `{"es": {"grumpy": ["perdona"]}}`)},
+	} {
+		if k, err := LoadKeywords(c.fname); err == nil {
+			t.Errorf("%v: loaded %v", c.name, k)
+		}
+	}
+}
@@ -2,22 +2,81 @@ package walle
 
 import (
 	"context"
+	"sync"
 
 	language "cloud.google.com/go/language/apiv1"
+	"github.com/golang/glog"
 	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
 )
 
-// Analyze Sentiment analyzes the sentiment of the txt string and returns the sentiment and
-// magnitude of the sentiment.
-func AnalyzeSentiment(txt string) (score float32, magnitude float32, err error) {
+// Sentiment analyzers selectable in WallEConfig.
+const (
+	SENTIMENT_GOOGLE  = "google"
+	SENTIMENT_LEXICON = "lexicon"
+)
+
+// SentimentAnalyzer scores the sentiment of text in lang, a BCP-47 code. The
+// score runs from -1, negative, to 1, positive; the magnitude from 0 up with
+// the amount of emotional content.
+type SentimentAnalyzer interface {
+	Analyze(txt string, lang string) (score float32, magnitude float32, err error)
+}
+
+// GoogleSentiment analyzes sentiment with the Cloud Natural Language API.
+type GoogleSentiment struct {
+	clients *Clients
+}
 
-	ctx := context.Background()
+// NewGoogleSentiment returns a GoogleSentiment calling the API with clients.
+func NewGoogleSentiment(clients *Clients) *GoogleSentiment {
+	return &GoogleSentiment{clients: clients}
+}
 
-	// Creates a client.
-	client, err := language.NewClient(ctx)
+func (s *GoogleSentiment) Analyze(txt string, lang string) (float32, float32, error) {
+	client, err := s.clients.Language()
 	if err != nil {
-		return
+		return 0, 0, err
+	}
+	ctx, cancel := s.clients.Context()
+	defer cancel()
+	return AnalyzeSentimentContext(ctx, client, txt, lang)
+}
+
+// fallbackSentiment tries the fallback when primary fails.
+type fallbackSentiment struct {
+	primary  SentimentAnalyzer
+	fallback SentimentAnalyzer
+}
+
+func (s *fallbackSentiment) Analyze(txt string, lang string) (float32, float32, error) {
+	score, magnitude, err := s.primary.Analyze(txt, lang)
+	if err == nil {
+		return score, magnitude, nil
 	}
+	glog.Warningf("Sentiment analysis failed, falling back to the lexicon: %v", err)
+	return s.fallback.Analyze(txt, lang)
+}
+
+var (
+	defaultSentimentOnce sync.Once
+	defaultSentiment     *GoogleSentiment
+)
+
+// Analyze Sentiment analyzes the sentiment of the txt string and returns the
+// sentiment and magnitude of the sentiment. The language is detected.
+//
+// Deprecated: Use a SentimentAnalyzer.
+func AnalyzeSentiment(txt string) (score float32, magnitude float32, err error) {
+	defaultSentimentOnce.Do(func() {
+		defaultSentiment = NewGoogleSentiment(NewClients(0))
+	})
+	return defaultSentiment.Analyze(txt, "")
+}
+
+// AnalyzeSentimentContext analyzes the sentiment of the txt string in lang, a
+// BCP-47 code, with client and returns the sentiment and magnitude of the
+// sentiment. An empty lang is detected.
+func AnalyzeSentimentContext(ctx context.Context, client *language.Client, txt string, lang string) (score float32, magnitude float32, err error) {
 
 	// Sets the text to analyze.
 
@@ -27,7 +86,8 @@ func AnalyzeSentiment(txt string) (score float32, magnitude float32, err error)
 			Source: &languagepb.Document_Content{
 				Content: txt,
 			},
-			Type: languagepb.Document_PLAIN_TEXT,
+			Type:     languagepb.Document_PLAIN_TEXT,
+			Language: lang,
 		},
 		EncodingType: languagepb.EncodingType_UTF8,
 	}
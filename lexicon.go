@@ -0,0 +1,162 @@
+package walle
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/golang/glog"
+)
+
+const (
+	LEXICON_LANGUAGE = "en"  // Language of the lexicon words.
+	LEXICON_MAX      = 5     // Valence of the strongest lexicon words.
+	LEXICON_ALPHA    = 15    // Normalizes the summed valence to a score.
+	NEGATION_SCALE   = -0.74 // Scales the valence of negated words.
+	NEGATION_WORDS   = 3     // Words back a negation reaches.
+	BUT_BEFORE       = 0.5   // Weight of words before "but".
+	BUT_AFTER        = 1.5   // Weight of words after "but".
+)
+
+// Lexicon maps words to their valence, from -LEXICON_MAX to LEXICON_MAX.
+type Lexicon map[string]float64
+
+// LEXICON is the built in lexicon of English words, AFINN style.
+var LEXICON = Lexicon{
+	"amazing": 4, "awesome": 4, "beautiful": 3, "best": 3, "better": 2,
+	"brilliant": 4, "congrats": 2, "congratulations": 2, "cool": 1,
+	"delighted": 3, "enjoy": 2, "excellent": 3, "excited": 3, "fantastic": 4,
+	"fine": 2, "fun": 4, "funny": 4, "glad": 3, "good": 3, "great": 3,
+	"happy": 3, "helpful": 2, "hope": 2, "interesting": 2, "joy": 3,
+	"like": 2, "love": 3, "lucky": 3, "nice": 3, "perfect": 3, "pleased": 3,
+	"safe": 1, "smile": 2, "super": 3, "sure": 1, "sweet": 2, "thank": 2,
+	"thanks": 2, "welcome": 2, "win": 4, "wonderful": 4, "yes": 1,
+
+	"afraid": -2, "angry": -3, "annoying": -2, "awful": -3, "bad": -3,
+	"boring": -3, "cry": -1, "danger": -2, "dangerous": -2, "dead": -3,
+	"death": -2, "difficult": -1, "disappointed": -2, "disappointing": -2,
+	"error": -2, "fail": -2, "failed": -2, "fear": -2, "hate": -3,
+	"horrible": -3, "hurt": -2, "kill": -3, "lose": -3, "lost": -3, "mad": -3,
+	"pain": -2, "poor": -2, "problem": -2, "sad": -2, "scary": -2, "sick": -2,
+	"sorry": -1, "stupid": -2, "terrible": -3, "ugly": -3, "unable": -2,
+	"unfortunately": -2, "upset": -2, "worried": -3, "worry": -3, "worse": -3,
+	"worst": -3, "wrong": -2,
+}
+
+// INTENSIFIERS scale the valence of the word they precede.
+var INTENSIFIERS = map[string]float64{
+	"absolutely": 1.8, "completely": 1.5, "extremely": 2, "incredibly": 2,
+	"really": 1.5, "so": 1.5, "too": 1.3, "totally": 1.5, "very": 1.5,
+	"quite": 1.2, "barely": 0.4, "slightly": 0.5, "somewhat": 0.7,
+}
+
+// NEGATIONS flip the valence of the words after them, as do words ending in
+// "n't".
+var NEGATIONS = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nobody": true,
+	"nothing": true, "neither": true, "nor": true, "without": true,
+	"cannot": true, "dont": true, "cant": true, "wont": true, "isnt": true,
+}
+
+// LoadLexicon returns LEXICON with the words in the AFINN file fname, a word
+// or phrase and its valence per line separated by a tab. Phrases are skipped.
+func LoadLexicon(fname string) (Lexicon, error) {
+	fh, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	l := make(Lexicon)
+	for w, v := range LEXICON {
+		l[w] = v
+	}
+	scanner := bufio.NewScanner(fh)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%v:%v: no valence", fname, n)
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fname, n, err)
+		}
+		word := strings.ToLower(strings.TrimSpace(line[:i]))
+		if strings.ContainsAny(word, " \t") {
+			continue
+		}
+		l[word] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LexiconSentiment analyzes sentiment offline by adding up the valence of the
+// words in a Lexicon, VADER style. Text in languages other than
+// LEXICON_LANGUAGE scores neutral.
+type LexiconSentiment struct {
+	lexicon Lexicon
+}
+
+// NewLexiconSentiment returns a LexiconSentiment using lexicon.
+func NewLexiconSentiment(lexicon Lexicon) *LexiconSentiment {
+	return &LexiconSentiment{lexicon: lexicon}
+}
+
+// Analyze returns the score, -1 to 1, and the magnitude, the summed strength
+// of the sentiment words, each 0 to 1, of txt. An empty lang is taken to be
+// LEXICON_LANGUAGE.
+func (s *LexiconSentiment) Analyze(txt string, lang string) (float32, float32, error) {
+	if base := strings.SplitN(lang, "-", 2)[0]; base != "" && !strings.EqualFold(base, LEXICON_LANGUAGE) {
+		glog.V(2).Infof("No sentiment lexicon for %v, taking the text as neutral", lang)
+		return 0, 0, nil
+	}
+
+	// Typographic apostrophes, as in "don’t", are apostrophes too.
+	txt = strings.ReplaceAll(strings.ToLower(txt), "\u2019", "'")
+	words := strings.FieldsFunc(txt, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	var sum, magnitude float64
+	weight := 1.0
+	for i, w := range words {
+		if w == "but" {
+			sum *= BUT_BEFORE
+			weight = BUT_AFTER
+			continue
+		}
+		v, ok := s.lexicon[w]
+		if !ok {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			scale, ok := INTENSIFIERS[words[j]]
+			if !ok {
+				break
+			}
+			v *= scale
+		}
+		for j := i - 1; j >= 0 && j >= i-NEGATION_WORDS; j-- {
+			if NEGATIONS[words[j]] || strings.HasSuffix(words[j], "n't") {
+				v *= NEGATION_SCALE
+				break
+			}
+		}
+		v = math.Max(-LEXICON_MAX, math.Min(LEXICON_MAX, v))
+		sum += v * weight
+		magnitude += math.Abs(v) / LEXICON_MAX
+	}
+	score := sum / math.Sqrt(sum*sum+LEXICON_ALPHA)
+	return float32(score), float32(magnitude), nil
+}
@@ -0,0 +1,90 @@
+package walle
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func analyze(t *testing.T, s SentimentAnalyzer, txt, lang string) float32 {
+	t.Helper()
+	score, magnitude, err := s.Analyze(txt, lang)
+	if err != nil {
+		t.Fatalf("Analyze(%q): %v", txt, err)
+	}
+	if score < -1 || score > 1 || magnitude < 0 {
+		t.Errorf("Analyze(%q) = %v, %v; out of range", txt, score, magnitude)
+	}
+	return score
+}
+
+func TestLexiconSentiment(t *testing.T) {
+	s := NewLexiconSentiment(LEXICON)
+	for _, c := range []struct {
+		txt    string
+		lo, hi float32
+	}{
+		{"The weather is cloudy", 0, 0},
+		{"That's great!", 0.4, 1},
+		{"That's not great", -1, -0.2},
+		{"I don't like it", -1, -0.1},
+		{"I don’t like it", -1, -0.1}, // Typographic apostrophe.
+		{"It was bad but the ending was amazing", 0.4, 1},
+	} {
+		if score := analyze(t, s, c.txt, "en-US"); score < c.lo || score > c.hi {
+			t.Errorf("%q scores %v, want %v to %v", c.txt, score, c.lo, c.hi)
+		}
+	}
+
+	// Intensifiers strengthen, negations flip.
+	good := analyze(t, s, "It's good", "en")
+	if very := analyze(t, s, "It's very good", "en"); very <= good {
+		t.Errorf("very good scores %v, not above good at %v", very, good)
+	}
+	if slightly := analyze(t, s, "It's slightly good", "en"); slightly >= good || slightly <= 0 {
+		t.Errorf("slightly good scores %v, want between 0 and good at %v", slightly, good)
+	}
+	if not := analyze(t, s, "It's never good", ""); not >= 0 {
+		t.Errorf("never good scores %v, want negative", not)
+	}
+}
+
+func TestLexiconSentimentOtherLanguages(t *testing.T) {
+	s := NewLexiconSentiment(LEXICON)
+	for _, lang := range []string{"es-MX", "hi", "FR"} {
+		if score := analyze(t, s, "good great happy", lang); score != 0 {
+			t.Errorf("%v text scores %v, want neutral", lang, score)
+		}
+	}
+	if score := analyze(t, s, "good", "EN-gb"); score <= 0 {
+		t.Errorf("EN-gb text scores %v, want positive", score)
+	}
+}
+
+func TestLoadLexicon(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "afinn.txt")
+	data := "# Comment\nmeh\t-2\ndoes not work\t-3\nGood 1\n"
+	if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadLexicon(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l["meh"] != -2 || l["good"] != 1 || l["great"] != LEXICON["great"] {
+		t.Errorf("got meh=%v good=%v great=%v, want -2, 1 and %v", l["meh"], l["good"], l["great"], LEXICON["great"])
+	}
+	if _, ok := l["does not work"]; ok {
+		t.Errorf("phrase loaded")
+	}
+	if LEXICON["good"] == 1 {
+		t.Errorf("built in lexicon changed")
+	}
+
+	if err := ioutil.WriteFile(fname, []byte("meh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLexicon(fname); err == nil {
+		t.Errorf("loaded a word without valence")
+	}
+}
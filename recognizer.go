@@ -0,0 +1,168 @@
+package walle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/deepakkamesh/walle/stt"
+	"github.com/golang/glog"
+)
+
+// Speech recognizers selectable in WallEConfig.
+const (
+	RECOGNIZER_GOOGLE  = "google"
+	RECOGNIZER_OFFLINE = "offline"
+	RECOGNIZER_FAKE    = "fake"
+)
+
+const (
+	RECOGNIZE_TIMEOUT = 30 * time.Second
+)
+
+// Recognizer transcribes LINEAR16 speech at 16kHz.
+type Recognizer interface {
+	Recognize(data []byte) (*stt.Transcript, error)
+}
+
+// StreamRecognizer is a Recognizer that can also transcribe audio while it is
+// still arriving.
+type StreamRecognizer interface {
+	Recognizer
+	NewStream() (*stt.Stream, error)
+}
+
+// GoogleRecognizer transcribes with the Google Cloud Speech API.
+type GoogleRecognizer struct {
+	lang    stt.Language
+	clients *Clients
+}
+
+// NewGoogleRecognizer returns a GoogleRecognizer of lang calling the Speech
+// API with clients.
+func NewGoogleRecognizer(lang stt.Language, clients *Clients) *GoogleRecognizer {
+	return &GoogleRecognizer{lang: lang, clients: clients}
+}
+
+func (s *GoogleRecognizer) Recognize(data []byte) (*stt.Transcript, error) {
+	client, err := s.clients.Speech()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.clients.Context()
+	defer cancel()
+	t, err := stt.Recognize(ctx, client, data, s.lang)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range t.Segments {
+		for _, alt := range seg.Alternatives {
+			glog.V(3).Infof("\"%v\" (confidence=%3f)\n", alt.Text, alt.Confidence)
+		}
+	}
+	return t, nil
+}
+
+func (s *GoogleRecognizer) NewStream() (*stt.Stream, error) {
+	client, err := s.clients.Speech()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.clients.StreamContext()
+	stream, err := stt.NewStream(ctx, client, s.lang)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stream.SetCloseTimeout(s.clients.timeout)
+	go func() {
+		<-stream.Done()
+		cancel()
+	}()
+	return stream, nil
+}
+
+// OfflineRecognizer transcribes with a local speech recognition command, e.g.
+// pocketsphinx, run on a WAV file of the audio. The command prints the
+// transcript.
+type OfflineRecognizer struct {
+	command []string
+}
+
+// NewOfflineRecognizer returns an OfflineRecognizer running command, which is
+// split on spaces, with the WAV file appended.
+func NewOfflineRecognizer(command string) *OfflineRecognizer {
+	return &OfflineRecognizer{command: strings.Fields(command)}
+}
+
+func (s *OfflineRecognizer) Recognize(data []byte) (*stt.Transcript, error) {
+	if len(s.command) == 0 {
+		return nil, errors.New("no offline speech recognition command")
+	}
+
+	fh, err := ioutil.TempFile("", "walle-stt-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fh.Name())
+	if err := audio.WriteWAV(fh, audio.BytesToSamples(data), audio.DEFAULT_FORMAT); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	if err := fh.Close(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RECOGNIZE_TIMEOUT)
+	defer cancel()
+	args := append(append([]string{}, s.command[1:]...), fh.Name())
+	out, err := exec.CommandContext(ctx, s.command[0], args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return stt.FromText(strings.Join(strings.Fields(string(out)), " ")), nil
+}
+
+// FakeRecognizer answers with scripted transcripts in turn, for testing.
+type FakeRecognizer struct {
+	lock        sync.Mutex
+	transcripts []string
+	next        int
+}
+
+// NewFakeRecognizer returns a FakeRecognizer answering with transcripts.
+func NewFakeRecognizer(transcripts ...string) *FakeRecognizer {
+	return &FakeRecognizer{transcripts: transcripts}
+}
+
+func (s *FakeRecognizer) Recognize(data []byte) (*stt.Transcript, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.transcripts) == 0 {
+		return stt.FromText(""), nil
+	}
+	txt := s.transcripts[s.next%len(s.transcripts)]
+	s.next++
+	return stt.FromText(txt), nil
+}
+
+// fallbackRecognizer tries the fallback when primary fails.
+type fallbackRecognizer struct {
+	primary  Recognizer
+	fallback Recognizer
+}
+
+func (s *fallbackRecognizer) Recognize(data []byte) (*stt.Transcript, error) {
+	t, err := s.primary.Recognize(data)
+	if err == nil {
+		return t, nil
+	}
+	glog.Warningf("Speech recognition failed, falling back to offline recognition: %v", err)
+	return s.fallback.Recognize(data)
+}
@@ -0,0 +1,92 @@
+package walle
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deepakkamesh/walle/stt"
+)
+
+// failingRecognizer always fails with err.
+type failingRecognizer struct {
+	err error
+}
+
+func (s *failingRecognizer) Recognize(data []byte) (*stt.Transcript, error) {
+	return nil, s.err
+}
+
+func recognize(t *testing.T, r Recognizer) string {
+	t.Helper()
+	tr, err := r.Recognize(make([]byte, 320))
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if !tr.Final {
+		t.Errorf("transcript of %q isn't final", tr.Text())
+	}
+	return tr.Text()
+}
+
+func TestFakeRecognizer(t *testing.T) {
+	r := NewFakeRecognizer("hello there", " good  bye ", "")
+	for _, want := range []string{"hello there", "good  bye", "", "hello there"} {
+		if got := recognize(t, r); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFakeRecognizerEmpty(t *testing.T) {
+	r := NewFakeRecognizer()
+	for i := 0; i < 2; i++ {
+		if got := recognize(t, r); got != "" {
+			t.Errorf("got %q, want nothing", got)
+		}
+	}
+}
+
+func TestFallbackRecognizer(t *testing.T) {
+	r := &fallbackRecognizer{
+		primary:  NewFakeRecognizer("primary"),
+		fallback: NewFakeRecognizer("fallback"),
+	}
+	if got := recognize(t, r); got != "primary" {
+		t.Errorf("got %q, want the primary transcript", got)
+	}
+
+	r.primary = &failingRecognizer{errors.New("offline")}
+	if got := recognize(t, r); got != "fallback" {
+		t.Errorf("got %q, want the fallback transcript", got)
+	}
+
+	want := errors.New("fallback failed too")
+	r.fallback = &failingRecognizer{want}
+	if _, err := r.Recognize(nil); err != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+}
+
+func TestOfflineRecognizer(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no shell")
+	}
+	// The command gets the WAV file as its last argument.
+	script := filepath.Join(t.TempDir(), "recognize")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\ntest -s \"$2\" && echo \"  hello\n  world \"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := recognize(t, NewOfflineRecognizer(script+" -infile")); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+
+	if _, err := NewOfflineRecognizer(script + "-missing").Recognize(nil); err == nil {
+		t.Errorf("missing command succeeded")
+	}
+	if _, err := NewOfflineRecognizer("").Recognize(nil); err == nil {
+		t.Errorf("empty command succeeded")
+	}
+}
@@ -0,0 +1,263 @@
+/* Package recorder saves conversations for debugging.
+*
+* Each session is written to the recording directory as three files sharing a
+* timestamp: <ts>-mic.wav, <ts>-reply.wav and a <ts>.json sidecar describing
+* what happened. Old sessions are deleted to stay within the configured limits.
+ */
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+const (
+	TIME_FORMAT  = "20060102-150405.000"
+	MIC_SUFFIX   = "-mic.wav"
+	REPLY_SUFFIX = "-reply.wav"
+	META_SUFFIX  = ".json"
+)
+
+// Config configures a Recorder. Zero limits are not enforced.
+type Config struct {
+	Dir         string        // Recording directory; empty disables recording.
+	MaxSessions int           // Sessions to keep.
+	MaxBytes    int64         // Total size of recordings to keep.
+	MaxAge      time.Duration // Age after which sessions are deleted.
+}
+
+type Recorder struct {
+	c    Config
+	lock sync.Mutex // Serializes retention passes.
+}
+
+// New returns a Recorder, or nil if c.Dir is empty. All Recorder methods are
+// safe to call on nil.
+func New(c Config) (*Recorder, error) {
+	if c.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording dir: %v", err)
+	}
+	return &Recorder{c: c}, nil
+}
+
+// Meta is the JSON sidecar of a session.
+type Meta struct {
+	ID                 string    `json:"id"`
+	Start              time.Time `json:"start"`
+	End                time.Time `json:"end"`
+	MicFile            string    `json:"mic_file,omitempty"`
+	ReplyFile          string    `json:"reply_file,omitempty"`
+	RequestText        string    `json:"request_text,omitempty"`  // What the assistant heard.
+	ResponseText       string    `json:"response_text,omitempty"` // What the assistant said it said.
+	Transcript         string    `json:"transcript,omitempty"`    // Speech to text of the reply.
+	Confidence         float32   `json:"confidence,omitempty"`    // Of the transcript; 0 if unknown.
+	SentimentScore     float32   `json:"sentiment_score"`
+	SentimentMagnitude float32   `json:"sentiment_magnitude"`
+	Emotion            string    `json:"emotion,omitempty"`
+	Errors             []string  `json:"errors,omitempty"`
+}
+
+// Session collects one conversation until Close.
+type Session struct {
+	r     *Recorder
+	lock  sync.Mutex
+	mic   bytes.Buffer
+	reply bytes.Buffer
+	meta  Meta
+}
+
+// Start begins recording a new session.
+func (r *Recorder) Start() *Session {
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	return &Session{
+		r: r,
+		meta: Meta{
+			ID:    now.Format(TIME_FORMAT),
+			Start: now,
+		},
+	}
+}
+
+// MicAudio appends LINEAR16 mic input.
+func (s *Session) MicAudio(data []byte) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.mic.Write(data)
+}
+
+// ReplyAudio appends LINEAR16 assistant output.
+func (s *Session) ReplyAudio(data []byte) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reply.Write(data)
+}
+
+// Transcript records the assistant's own view of the exchange.
+func (s *Session) Transcript(request, response string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if request != "" {
+		s.meta.RequestText = request
+	}
+	if response != "" {
+		s.meta.ResponseText = response
+	}
+}
+
+// Update changes the sidecar through f, e.g. to add the sentiment.
+func (s *Session) Update(f func(m *Meta)) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f(&s.meta)
+}
+
+// Error notes a failure during the session.
+func (s *Session) Error(err error) {
+	s.Update(func(m *Meta) {
+		m.Errors = append(m.Errors, err.Error())
+	})
+}
+
+// Close writes the session to disk and enforces the retention limits.
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.meta.End = time.Now()
+	base := filepath.Join(s.r.c.Dir, s.meta.ID)
+
+	if s.mic.Len() > 0 {
+		if err := writeWAV(base+MIC_SUFFIX, s.mic.Bytes()); err != nil {
+			glog.Warningf("Failed to save mic recording: %v", err)
+		} else {
+			s.meta.MicFile = filepath.Base(base + MIC_SUFFIX)
+		}
+	}
+	if s.reply.Len() > 0 {
+		if err := writeWAV(base+REPLY_SUFFIX, s.reply.Bytes()); err != nil {
+			glog.Warningf("Failed to save reply recording: %v", err)
+		} else {
+			s.meta.ReplyFile = filepath.Base(base + REPLY_SUFFIX)
+		}
+	}
+	meta, err := json.MarshalIndent(s.meta, "", "  ")
+	s.lock.Unlock()
+	if err != nil {
+		glog.Warningf("Failed to encode session metadata: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(base+META_SUFFIX, meta, 0644); err != nil {
+		glog.Warningf("Failed to save session metadata: %v", err)
+	}
+	glog.V(2).Infof("Recorded session %v", base)
+
+	s.r.retain()
+}
+
+func writeWAV(fname string, data []byte) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if err := audio.WriteWAV(f, audio.BytesToSamples(data), audio.DEFAULT_FORMAT); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// retain deletes the oldest sessions until the recordings are within limits.
+func (r *Recorder) retain() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	files, err := ioutil.ReadDir(r.c.Dir)
+	if err != nil {
+		glog.Warningf("Failed to list recordings: %v", err)
+		return
+	}
+
+	// Group files by session ID; IDs sort by time.
+	sizes := map[string]int64{}
+	names := map[string][]string{}
+	var total int64
+	for _, f := range files {
+		id := sessionID(f.Name())
+		if id == "" {
+			continue
+		}
+		sizes[id] += f.Size()
+		names[id] = append(names[id], f.Name())
+		total += f.Size()
+	}
+	ids := make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	cutoff := time.Now().Add(-r.c.MaxAge)
+	for len(ids) > 0 {
+		id := ids[0]
+		start, _ := time.ParseInLocation(TIME_FORMAT, id, time.Local)
+		switch {
+		case r.c.MaxSessions > 0 && len(ids) > r.c.MaxSessions:
+		case r.c.MaxBytes > 0 && total > r.c.MaxBytes:
+		case r.c.MaxAge > 0 && start.Before(cutoff):
+		default:
+			return
+		}
+		for _, n := range names[id] {
+			if err := os.Remove(filepath.Join(r.c.Dir, n)); err != nil {
+				glog.Warningf("Failed to delete old recording: %v", err)
+			}
+		}
+		glog.V(2).Infof("Deleted old recording %v", id)
+		total -= sizes[id]
+		ids = ids[1:]
+	}
+}
+
+// sessionID returns the session a recording file belongs to, or "" if it is
+// not a recording.
+func sessionID(name string) string {
+	for _, suffix := range []string{MIC_SUFFIX, REPLY_SUFFIX, META_SUFFIX} {
+		if strings.HasSuffix(name, suffix) {
+			id := strings.TrimSuffix(name, suffix)
+			if _, err := time.Parse(TIME_FORMAT, id); err == nil {
+				return id
+			}
+		}
+	}
+	return ""
+}
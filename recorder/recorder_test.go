@@ -0,0 +1,145 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/deepakkamesh/walle/audio"
+)
+
+// makeSession writes the files of a session that started at start, with a
+// mic recording of size bytes, and returns its ID.
+func makeSession(t *testing.T, dir string, start time.Time, size int) string {
+	t.Helper()
+	id := start.Format(TIME_FORMAT)
+	if err := ioutil.WriteFile(filepath.Join(dir, id+MIC_SUFFIX), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, id+META_SUFFIX), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// sessions returns the IDs of the sessions in dir, oldest first.
+func sessions(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, f := range files {
+		if id := sessionID(f.Name()); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRetain(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		name string
+		c    Config
+		keep int // Newest sessions kept of the 4.
+	}{
+		{"unlimited", Config{}, 4},
+		{"sessions", Config{MaxSessions: 2}, 2},
+		{"bytes", Config{MaxBytes: 3100}, 3},
+		{"age", Config{MaxAge: 90 * time.Minute}, 2},
+		{"strictest", Config{MaxSessions: 3, MaxBytes: 5000, MaxAge: 30 * time.Minute}, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c.c.Dir = dir
+			r, err := New(c.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for i := 3; i >= 0; i-- {
+				ids = append(ids, makeSession(t, dir, now.Add(-time.Duration(i)*time.Hour), 1000))
+			}
+			other := filepath.Join(dir, "notes.txt")
+			if err := ioutil.WriteFile(other, make([]byte, 10000), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r.retain()
+			got := sessions(t, dir)
+			want := ids[len(ids)-c.keep:]
+			if len(got) != len(want) {
+				t.Fatalf("kept sessions %v, want %v", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("kept sessions %v, want %v", got, want)
+					break
+				}
+			}
+			if _, err := os.Stat(other); err != nil {
+				t.Errorf("deleted a file that isn't a recording: %v", err)
+			}
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	r, err := New(Config{Dir: dir, MaxSessions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := makeSession(t, dir, time.Now().Add(-time.Hour), 100)
+
+	s := r.Start()
+	s.MicAudio(audio.SamplesToBytes([]int16{1, 2}))
+	s.MicAudio(audio.SamplesToBytes([]int16{3}))
+	s.Transcript("what time is it", "")
+	s.Transcript("", "it's noon")
+	s.Update(func(m *Meta) { m.Emotion = "happy" })
+	s.Close()
+
+	if ids := sessions(t, dir); len(ids) != 1 || ids[0] == old {
+		t.Fatalf("got sessions %v, want only the new one", ids)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, s.meta.ID+META_SUFFIX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.RequestText != "what time is it" || m.ResponseText != "it's noon" || m.Emotion != "happy" {
+		t.Errorf("got sidecar %+v", m)
+	}
+	if m.MicFile != s.meta.ID+MIC_SUFFIX || m.ReplyFile != "" {
+		t.Errorf("got mic file %q and reply file %q, want %q and none", m.MicFile, m.ReplyFile, s.meta.ID+MIC_SUFFIX)
+	}
+	samples, _, err := audio.ReadWAVFile(filepath.Join(dir, m.MicFile))
+	if err != nil || len(samples) != 3 || samples[2] != 3 {
+		t.Errorf("got mic samples %v (%v), want [1 2 3]", samples, err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	r, err := New(Config{})
+	if r != nil || err != nil {
+		t.Fatalf("got %v, %v; want a nil Recorder", r, err)
+	}
+	// A nil Recorder records nothing without failing.
+	s := r.Start()
+	s.MicAudio([]byte{1, 2})
+	s.Transcript("hi", "hello")
+	s.Close()
+}
@@ -0,0 +1,62 @@
+package sfx
+
+import "time"
+
+const ms = time.Millisecond
+
+// Envelopes.
+var (
+	PLUCK = Envelope{Attack: 5 * ms, Decay: 60 * ms, Sustain: 0.6, Release: 40 * ms}
+	SWELL = Envelope{Attack: 80 * ms, Decay: 100 * ms, Sustain: 0.8, Release: 120 * ms}
+	CLICK = Envelope{Attack: 2 * ms, Decay: 20 * ms, Sustain: 0.3, Release: 10 * ms}
+)
+
+// EFFECTS are the built in effects.
+var EFFECTS = map[string]Effect{
+	// Short rising blip.
+	"chirp": {
+		{Wave: SINE, From: 900, To: 2400, Duration: 90 * ms, Gain: 0.6, Env: PLUCK},
+	},
+	// Two quick chirps up, pleased.
+	"chirp_happy": {
+		{Wave: SINE, From: 800, To: 1800, Duration: 80 * ms, Gain: 0.6, Env: PLUCK},
+		{Wave: SINE, From: 1200, To: 2800, At: 110 * ms, Duration: 110 * ms, Gain: 0.6, Env: PLUCK},
+	},
+	// Servo whir.
+	"whir": {
+		{Wave: SAW, From: 180, To: 260, Duration: 400 * ms, Gain: 0.2, Env: SWELL, Vibrato: 30, Depth: 0.5},
+		{Wave: NOISE, Duration: 400 * ms, Gain: 0.05, Env: SWELL},
+	},
+	// Servo whir winding down.
+	"whir_down": {
+		{Wave: SAW, From: 260, To: 90, Duration: 700 * ms, Gain: 0.2, Env: SWELL, Vibrato: 20, Depth: 0.5},
+		{Wave: NOISE, Duration: 700 * ms, Gain: 0.04, Env: SWELL},
+	},
+	// Plain beep.
+	"beep": {
+		{Wave: SQUARE, From: 1000, Duration: 120 * ms, Gain: 0.25, Env: CLICK},
+	},
+	// Two low beeps, something is wrong.
+	"beep_error": {
+		{Wave: SQUARE, From: 440, Duration: 150 * ms, Gain: 0.25, Env: CLICK},
+		{Wave: SQUARE, From: 330, At: 200 * ms, Duration: 250 * ms, Gain: 0.25, Env: CLICK},
+	},
+	// Rising and falling wonder.
+	"whoa": {
+		{Wave: TRIANGLE, From: 300, To: 900, Duration: 250 * ms, Gain: 0.5, Env: SWELL, Vibrato: 6, Depth: 0.3},
+		{Wave: TRIANGLE, From: 900, To: 400, At: 250 * ms, Duration: 400 * ms, Gain: 0.5, Env: SWELL, Vibrato: 6, Depth: 0.5},
+	},
+	// Falling sigh.
+	"whoa_down": {
+		{Wave: TRIANGLE, From: 700, To: 200, Duration: 600 * ms, Gain: 0.5, Env: SWELL, Vibrato: 5, Depth: 0.6},
+	},
+	// Rising question.
+	"whoa_up": {
+		{Wave: TRIANGLE, From: 350, To: 1100, Duration: 450 * ms, Gain: 0.5, Env: SWELL, Vibrato: 7, Depth: 0.3},
+	},
+	// Angry buzz.
+	"buzz": {
+		{Wave: SQUARE, From: 140, To: 110, Duration: 350 * ms, Gain: 0.25, Env: PLUCK, Vibrato: 25, Depth: 1},
+		{Wave: SAW, From: 210, To: 160, Duration: 350 * ms, Gain: 0.15, Env: PLUCK},
+	},
+}
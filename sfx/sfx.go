@@ -0,0 +1,202 @@
+/* Package sfx synthesizes WallE's sound effects.
+*
+* An Effect is a set of tones, each an oscillator with a pitch glide and an
+* envelope, rendered to 16 bit samples. Named effects can be played on the
+* effects channel of an audio.Audio.
+ */
+package sfx
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deepakkamesh/walle/audio"
+)
+
+// Oscillator waveforms.
+const (
+	SINE byte = iota
+	SQUARE
+	SAW
+	TRIANGLE
+	NOISE
+)
+
+// Envelope shapes the loudness of a tone: it rises over Attack, falls to
+// Sustain over Decay and fades out over the last Release of the tone.
+type Envelope struct {
+	Attack  time.Duration
+	Decay   time.Duration
+	Sustain float64 // Level after Decay, 0 to 1.
+	Release time.Duration
+}
+
+// Tone is one oscillator note.
+type Tone struct {
+	Wave     byte
+	From     float64       // Start pitch in Hz.
+	To       float64       // End pitch in Hz; the pitch glides exponentially. 0 for From.
+	At       time.Duration // Start time in the effect.
+	Duration time.Duration
+	Gain     float64 // Peak level, 0 to 1.
+	Env      Envelope
+	Vibrato  float64 // Vibrato rate in Hz; 0 for none.
+	Depth    float64 // Vibrato depth in semitones.
+}
+
+// Effect is a set of tones played together.
+type Effect []Tone
+
+// Duration returns when the last tone of e ends.
+func (e Effect) Duration() time.Duration {
+	var d time.Duration
+	for _, t := range e {
+		if end := t.At + t.Duration; end > d {
+			d = end
+		}
+	}
+	return d
+}
+
+// Render renders e to mono samples at rate.
+func (e Effect) Render(rate int) []int16 {
+	acc := make([]float64, int(e.Duration().Seconds()*float64(rate)))
+	for _, t := range e {
+		t.render(acc, rate)
+	}
+	out := make([]int16, len(acc))
+	for i, v := range acc {
+		v = math.Max(-1, math.Min(1, v))
+		out[i] = int16(v * math.MaxInt16)
+	}
+	return out
+}
+
+// render adds the tone to acc.
+func (t Tone) render(acc []float64, rate int) {
+	start := int(t.At.Seconds() * float64(rate))
+	n := int(t.Duration.Seconds() * float64(rate))
+	to := t.To
+	if to == 0 {
+		to = t.From
+	}
+
+	phase := 0.0
+	for i := 0; i < n && start+i < len(acc); i++ {
+		sec := float64(i) / float64(rate)
+		frac := float64(i) / float64(n)
+		freq := 0.0
+		if t.From > 0 {
+			freq = t.From * math.Pow(to/t.From, frac)
+		}
+		if t.Vibrato > 0 {
+			freq *= math.Pow(2, t.Depth*math.Sin(2*math.Pi*t.Vibrato*sec)/12)
+		}
+		phase += freq / float64(rate)
+		phase -= math.Floor(phase)
+
+		acc[start+i] += wave(t.Wave, phase) * t.Gain * t.Env.level(sec, t.Duration.Seconds())
+	}
+}
+
+// wave returns waveform w at phase 0 to 1.
+func wave(w byte, phase float64) float64 {
+	switch w {
+	case SQUARE:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	case SAW:
+		return 2*phase - 1
+	case TRIANGLE:
+		return 1 - 4*math.Abs(phase-0.5)
+	case NOISE:
+		return 2*rand.Float64() - 1
+	}
+	return math.Sin(2 * math.Pi * phase)
+}
+
+// level returns the envelope level at t seconds into a tone of d seconds.
+func (e Envelope) level(t, d float64) float64 {
+	attack, decay, release := e.Attack.Seconds(), e.Decay.Seconds(), e.Release.Seconds()
+	l := e.Sustain
+	switch {
+	case t < attack:
+		l = t / attack
+	case t < attack+decay:
+		l = 1 - (1-e.Sustain)*(t-attack)/decay
+	}
+	if rel := d - t; rel < release {
+		l *= rel / release
+	}
+	return l
+}
+
+// Player plays named effects, rendering each once.
+type Player struct {
+	audio    *audio.Audio
+	lock     sync.Mutex
+	effects  map[string]Effect
+	rendered map[string][]int16
+}
+
+// NewPlayer returns a Player of EFFECTS on a.
+func NewPlayer(a *audio.Audio) *Player {
+	p := &Player{
+		audio:    a,
+		effects:  make(map[string]Effect),
+		rendered: make(map[string][]int16),
+	}
+	for name, e := range EFFECTS {
+		p.effects[name] = e
+	}
+	return p
+}
+
+// Add adds or replaces the effect name.
+func (s *Player) Add(name string, e Effect) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.effects[name] = e
+	delete(s.rendered, name)
+}
+
+// Names returns the names of the effects.
+func (s *Player) Names() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var names []string
+	for name := range s.effects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Play plays the effect name on the effects channel.
+func (s *Player) Play(name string) (*audio.Session, error) {
+	s.lock.Lock()
+	samples, ok := s.rendered[name]
+	if !ok {
+		e, found := s.effects[name]
+		if !found {
+			s.lock.Unlock()
+			return nil, fmt.Errorf("no sound effect %v", name)
+		}
+		samples = e.Render(audio.SAMPLE_RATE)
+		s.rendered[name] = samples
+	}
+	s.lock.Unlock()
+
+	session := s.audio.NewSessionOn(audio.CHANNEL_EFFECTS)
+	go func() {
+		session.PlaySamples(samples)
+		session.End()
+	}()
+	return session, nil
+}
@@ -2,75 +2,183 @@ package walle
 
 import (
 	"bytes"
-	"context"
-	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/deepakkamesh/walle/audio"
+	"github.com/deepakkamesh/walle/stt"
 	"github.com/golang/glog"
-
-	speech "cloud.google.com/go/speech/apiv1"
-	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
-)
-
-const (
-	CHUNK_SZ = 1600
 )
 
-// TextToSpeech plays the raw audio file identified by fname.
+// TextToSpeech plays the sound file identified by fname and waits for it to
+// finish. WAV, FLAC, Ogg Vorbis and headerless 16kHz LINEAR16 files are
+// supported.
 func TextToSpeech(fname string, aud *audio.Audio) error {
 	aud.ResetPlayback()
-	data, err := ioutil.ReadFile(fname)
+	session, err := aud.PlayClip(fname, audio.CHANNEL_SPEECH)
 	if err != nil {
 		return err
 	}
-	l := len(data)
-	for i := 0; i < l; i += CHUNK_SZ {
-		end := i + CHUNK_SZ
-		if end > l {
-			end = l
-		}
-		chunk := data[i:end]
-		buf := bytes.NewBuffer(chunk)
-		aud.Out <- *buf
-	}
-	<-aud.StatusCh
-	glog.V(3).Info("Finished Text2Speech")
+	session.Wait()
+	glog.V(3).Info("Finished playing speech")
 	return nil
 }
 
-func SpeechToText(audio *bytes.Buffer) (resultTxt string, err error) {
-	ctx := context.Background()
+var (
+	defaultRecognizerOnce sync.Once
+	defaultRecognizer     *GoogleRecognizer
+)
 
-	// Creates a client.
-	client, err := speech.NewClient(ctx)
+// SpeechToText transcribes LINEAR16 audio at 16kHz in en-US with the Google
+// Cloud Speech API.
+//
+// Deprecated: Use a Recognizer.
+func SpeechToText(buf *bytes.Buffer) (string, error) {
+	defaultRecognizerOnce.Do(func() {
+		defaultRecognizer = NewGoogleRecognizer(stt.Language{}, NewClients(0))
+	})
+	t, err := defaultRecognizer.Recognize(buf.Bytes())
 	if err != nil {
-		return
+		return "", err
 	}
+	return t.Text(), nil
+}
 
-	// Detects speech in the audio data.
-	req := &speechpb.RecognizeRequest{
-		Config: &speechpb.RecognitionConfig{
-			Encoding:        speechpb.RecognitionConfig_LINEAR16,
-			SampleRateHertz: 16000,
-			LanguageCode:    "en-US",
-		},
-		Audio: &speechpb.RecognitionAudio{
-			AudioSource: &speechpb.RecognitionAudio_Content{Content: audio.Bytes()},
-		},
-	}
-	resp, err := client.Recognize(ctx, req)
+// Say speaks text and waits for it to finish.
+func (s *WallE) Say(text string) error {
+	s.audio.ResetPlayback()
+	session, err := s.speaker.Say(text)
 	if err != nil {
-		return
+		return err
 	}
+	session.Wait()
+	return nil
+}
+
+// replyTranscriber is an assistant.Tap streaming reply audio to a speech
+// recognizer. The stream starts with the first reply audio, as the Speech API
+// ends streams left without audio while the user talks. The sentiment of the
+// final results is analyzed as they arrive, while the reply still plays.
+type replyTranscriber struct {
+	recognizer StreamRecognizer  // nil if not streaming.
+	sentiment  SentimentAnalyzer // nil to not analyze early.
+	language   string            // Of results without a detected language.
+	stream     *stt.Stream       // nil until the reply starts, or if it failed to.
+	watched    chan struct{}     // Closed once all results were handled.
+	failed     bool
+	started    time.Time // When reply audio started arriving; zero before.
+
+	lock  sync.Mutex // Guards early.
+	early *sentimentResult
+}
 
-	// Prints the results.
-	for _, result := range resp.Results {
-		for _, alt := range result.Alternatives {
-			resultTxt = alt.Transcript
-			glog.V(3).Infof("\"%v\" (confidence=%3f)\n", alt.Transcript, alt.Confidence)
+// sentimentResult is the sentiment of txt in lang, once done is closed.
+type sentimentResult struct {
+	txt       string
+	lang      string
+	done      chan struct{}
+	score     float32
+	magnitude float32
+	err       error
+}
+
+func (t *replyTranscriber) MicAudio(data []byte) {}
+
+func (t *replyTranscriber) ReplyAudio(data []byte) {
+	if t.started.IsZero() {
+		t.started = time.Now()
+	}
+	if t.recognizer == nil {
+		return
+	}
+	if t.stream == nil && !t.failed {
+		stream, err := t.recognizer.NewStream()
+		if err != nil {
+			glog.Warningf("Failed to start streaming speech recognition: %v", err)
+			t.failed = true
+			return
 		}
+		t.stream = stream
+		t.watched = make(chan struct{})
+		go t.watch(stream.Results)
+	}
+	if t.stream == nil {
+		return
 	}
+	if err := t.stream.Write(data); err != nil {
+		glog.V(2).Infof("Failed to stream reply audio to speech recognition: %v", err)
+	}
+}
+
+func (t *replyTranscriber) Transcript(request, response string) {}
 
-	return
+// Close waits for the transcript of the reply. It returns false if the reply
+// wasn't streamed, so it must be transcribed in one go.
+func (t *replyTranscriber) Close() (*stt.Transcript, bool, error) {
+	if t.stream == nil {
+		return nil, false, nil
+	}
+	tr, err := t.stream.Close()
+	<-t.watched
+	return tr, true, err
+}
+
+// Cancel abandons the transcription.
+func (t *replyTranscriber) Cancel() {
+	if t.stream != nil {
+		t.stream.Cancel()
+	}
+}
 
+// watch logs transcripts as the reply is recognized, and starts analyzing
+// the sentiment of the final text so far with each final result.
+func (t *replyTranscriber) watch(results <-chan stt.Transcript) {
+	defer close(t.watched)
+
+	var final []string
+	lang := ""
+	for tr := range results {
+		if !tr.Final {
+			glog.V(3).Infof("Recognizing reply: %v (stability=%.3f)", tr.Text(), tr.Stability)
+			continue
+		}
+		glog.V(2).Infof("Recognized reply: %v (confidence=%.3f)", tr.Text(), tr.Confidence())
+		if t.sentiment == nil || tr.Text() == "" {
+			continue
+		}
+		final = append(final, tr.Text())
+		if lang == "" {
+			lang = tr.Language()
+		}
+		r := &sentimentResult{
+			txt:  strings.Join(final, " "),
+			lang: lang,
+			done: make(chan struct{}),
+		}
+		if r.lang == "" {
+			r.lang = t.language
+		}
+		go func() {
+			defer close(r.done)
+			r.score, r.magnitude, r.err = t.sentiment.Analyze(r.txt, r.lang)
+		}()
+		t.lock.Lock()
+		t.early = r
+		t.lock.Unlock()
+	}
+}
+
+// Analyze returns the sentiment of txt in lang, waiting for the analysis
+// started early if it was of the same text.
+func (t *replyTranscriber) Analyze(txt string, lang string) (float32, float32, error) {
+	t.lock.Lock()
+	r := t.early
+	t.lock.Unlock()
+	if r != nil && r.txt == txt && r.lang == lang {
+		<-r.done
+		glog.V(2).Infof("Using sentiment analyzed while the reply played")
+		return r.score, r.magnitude, r.err
+	}
+	return t.sentiment.Analyze(txt, lang)
 }
@@ -0,0 +1,52 @@
+package walle
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deepakkamesh/walle/audio"
+)
+
+func TestTextToSpeech(t *testing.T) {
+	want := make([]int16, audio.SAMPLE_RATE/4)
+	for i := range want {
+		want[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/audio.SAMPLE_RATE))
+	}
+	fname := filepath.Join(t.TempDir(), "speech.wav")
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := audio.WriteWAV(f, want, audio.DEFAULT_FORMAT); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	lb := audio.NewLoopback()
+	aud := audio.NewWithBackend(lb)
+	if err := aud.Init(); err != nil {
+		t.Fatalf("audio Init: %v", err)
+	}
+	defer aud.Quit()
+	aud.StartPlayback()
+	defer aud.StopPlayback()
+
+	if err := TextToSpeech(fname, aud); err != nil {
+		t.Fatalf("TextToSpeech: %v", err)
+	}
+	played := lb.Played()
+	if len(played) < len(want) {
+		t.Fatalf("played %v samples, want at least %v", len(played), len(want))
+	}
+	for i := range want {
+		if played[i] != want[i] {
+			t.Fatalf("played sample %v is %v, want %v", i, played[i], want[i])
+		}
+	}
+
+	if err := TextToSpeech(filepath.Join(t.TempDir(), "missing.wav"), aud); err == nil {
+		t.Error("played a missing file")
+	}
+}
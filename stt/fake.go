@@ -0,0 +1,169 @@
+package stt
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/api/option"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	FAKE_BYTES_PER_WORD = SAMPLE_RATE / 2        // Audio revealing each interim word.
+	FAKE_WORD_TIME      = 250 * time.Millisecond // Time of FAKE_BYTES_PER_WORD.
+)
+
+// FakeServer is a local Speech API server for testing offline. Each
+// recognition answers with the next of its scripted transcripts: a word more
+// of it as an interim result per FAKE_BYTES_PER_WORD of audio, and all of it
+// as the final result once the audio ends. Final results time a word per
+// FAKE_WORD_TIME and are in the requested language.
+type FakeServer struct {
+	speechpb.UnimplementedSpeechServer
+
+	listener net.Listener
+	server   *grpc.Server
+
+	lock        sync.Mutex
+	transcripts []string
+	next        int
+}
+
+// NewFakeServer starts a FakeServer on a free local port, answering with
+// transcripts in turn.
+func NewFakeServer(transcripts ...string) (*FakeServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &FakeServer{
+		listener:    l,
+		server:      grpc.NewServer(),
+		transcripts: transcripts,
+	}
+	speechpb.RegisterSpeechServer(s.server, s)
+	go func() {
+		if err := s.server.Serve(l); err != nil {
+			glog.Errorf("Fake speech server failed: %v", err)
+		}
+	}()
+	glog.V(1).Infof("Fake speech server listening on %v", s.Addr())
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *FakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Options returns the client options to connect to the server.
+func (s *FakeServer) Options() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.Addr()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// Close stops the server.
+func (s *FakeServer) Close() {
+	s.server.Stop()
+}
+
+// transcript returns the next scripted transcript.
+func (s *FakeServer) transcript() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.transcripts) == 0 {
+		return ""
+	}
+	t := s.transcripts[s.next%len(s.transcripts)]
+	s.next++
+	return t
+}
+
+// Recognize answers a batch recognition.
+func (s *FakeServer) Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error) {
+	words := strings.Fields(s.transcript())
+	return &speechpb.RecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{fakeAlternative(words, true)},
+			LanguageCode: req.GetConfig().LanguageCode,
+		}},
+	}, nil
+}
+
+// StreamingRecognize answers a streaming recognition.
+func (s *FakeServer) StreamingRecognize(stream speechpb.Speech_StreamingRecognizeServer) error {
+	words := strings.Fields(s.transcript())
+	received, shown := 0, 0
+	language := LANGUAGE
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if c := req.GetStreamingConfig(); c != nil && c.Config != nil {
+			language = c.Config.LanguageCode
+		}
+		received += len(req.GetAudioContent())
+
+		n := received / FAKE_BYTES_PER_WORD
+		if n > len(words) {
+			n = len(words)
+		}
+		if n == shown {
+			continue
+		}
+		shown = n
+		if err := stream.Send(fakeResponse(words[:n], false, language)); err != nil {
+			return err
+		}
+	}
+	return stream.Send(fakeResponse(words, true, language))
+}
+
+func fakeResponse(words []string, final bool, language string) *speechpb.StreamingRecognizeResponse {
+	result := &speechpb.StreamingRecognitionResult{
+		Alternatives: []*speechpb.SpeechRecognitionAlternative{fakeAlternative(words, final)},
+		IsFinal:      final,
+		Stability:    0.5,
+	}
+	if final {
+		result.Stability = 1
+		result.LanguageCode = language
+	}
+	return &speechpb.StreamingRecognizeResponse{
+		Results: []*speechpb.StreamingRecognitionResult{result},
+	}
+}
+
+// fakeAlternative returns words as a recognized alternative, with the
+// details of a final result if final.
+func fakeAlternative(words []string, final bool) *speechpb.SpeechRecognitionAlternative {
+	alt := &speechpb.SpeechRecognitionAlternative{Transcript: strings.Join(words, " ")}
+	if !final {
+		return alt
+	}
+	alt.Confidence = 1
+	for i, w := range words {
+		alt.Words = append(alt.Words, &speechpb.WordInfo{
+			Word:       w,
+			StartTime:  durationpb.New(time.Duration(i) * FAKE_WORD_TIME),
+			EndTime:    durationpb.New(time.Duration(i+1) * FAKE_WORD_TIME),
+			Confidence: 1,
+		})
+	}
+	return alt
+}
@@ -0,0 +1,207 @@
+/* Package stt transcribes speech with the Google Cloud Speech API or a local
+* fake of it.
+*
+* Audio is transcribed in one go with Recognize, or written to a Stream in
+* chunks as it arrives; interim and final transcripts then come back on its
+* Results channel while audio is still being written.
+ */
+package stt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	speech "cloud.google.com/go/speech/apiv1"
+	"github.com/golang/glog"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+)
+
+const (
+	SAMPLE_RATE   = 16000
+	LANGUAGE      = "en-US"           // Default recognition language.
+	MAX_RUNTIME   = 240 * time.Second // Longest a stream may run.
+	CLOSE_TIMEOUT = 15 * time.Second  // Default wait of Close for the last results.
+)
+
+var errClosed = errors.New("speech stream closed")
+
+// Recognize transcribes LINEAR16 audio data at SAMPLE_RATE in lang with
+// client.
+func Recognize(ctx context.Context, client *speech.Client, data []byte, lang Language) (*Transcript, error) {
+	resp, err := client.Recognize(ctx, &speechpb.RecognizeRequest{
+		Config: recognitionConfig(lang),
+		Audio: &speechpb.RecognitionAudio{
+			AudioSource: &speechpb.RecognitionAudio_Content{Content: data},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromResponse(resp), nil
+}
+
+// Stream recognizes LINEAR16 audio at SAMPLE_RATE as it is written.
+type Stream struct {
+	Results chan Transcript // Closed once recognition ends.
+
+	stream       speechpb.Speech_StreamingRecognizeClient
+	cancel       context.CancelFunc
+	done         chan struct{}
+	closeTimeout time.Duration
+
+	sendLock sync.Mutex // Serializes sending; guards closed.
+	closed   bool
+
+	lock  sync.Mutex // Guards final and err.
+	final []Segment
+	err   error
+}
+
+// NewStream starts a recognition stream in lang with client. The stream
+// ends when ctx is done, or after MAX_RUNTIME.
+func NewStream(ctx context.Context, client *speech.Client, lang Language) (*Stream, error) {
+	ctx, cancel := context.WithTimeout(ctx, MAX_RUNTIME)
+	rs, err := client.StreamingRecognize(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newStream(rs, lang, cancel)
+}
+
+// newStream configures rs and starts receiving results.
+func newStream(rs speechpb.Speech_StreamingRecognizeClient, lang Language, cancel context.CancelFunc) (*Stream, error) {
+	req := &speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
+			StreamingConfig: &speechpb.StreamingRecognitionConfig{
+				Config:         recognitionConfig(lang),
+				InterimResults: true,
+			},
+		},
+	}
+	if err := rs.Send(req); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Stream{
+		Results:      make(chan Transcript, 10),
+		stream:       rs,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		closeTimeout: CLOSE_TIMEOUT,
+	}
+	go s.recv()
+	return s, nil
+}
+
+// Write sends the next chunk of audio.
+func (s *Stream) Write(data []byte) error {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	return s.stream.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+			AudioContent: data,
+		},
+	})
+}
+
+// SetCloseTimeout sets how long Close waits for the last results before
+// canceling recognition, CLOSE_TIMEOUT by default. Set it before Close.
+func (s *Stream) SetCloseTimeout(d time.Duration) {
+	s.closeTimeout = d
+}
+
+// Close ends the audio and waits up to the close timeout for the last
+// results. It returns the final results as one transcript.
+func (s *Stream) Close() (*Transcript, error) {
+	s.sendLock.Lock()
+	if !s.closed {
+		s.closed = true
+		if err := s.stream.CloseSend(); err != nil {
+			glog.V(2).Infof("Failed to end speech stream: %v", err)
+		}
+	}
+	s.sendLock.Unlock()
+
+	timer := time.NewTimer(s.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+	case <-timer.C:
+		glog.Warningf("Speech stream didn't end within %v, canceling", s.closeTimeout)
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &Transcript{Segments: s.final, Final: true}, nil
+}
+
+// Done returns a channel that is closed once recognition ended.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Cancel abandons recognition. It may be called after Close.
+func (s *Stream) Cancel() {
+	s.cancel()
+	<-s.done
+}
+
+// recv publishes results until the server ends the stream.
+func (s *Stream) recv() {
+	defer close(s.done)
+	defer close(s.Results)
+
+	for {
+		resp, err := s.stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err == nil && resp.GetError() != nil {
+			err = fmt.Errorf("speech recognition failed: %v", resp.GetError().GetMessage())
+		}
+		if err != nil {
+			s.lock.Lock()
+			s.err = err
+			s.lock.Unlock()
+			return
+		}
+
+		for _, result := range resp.GetResults() {
+			if len(result.GetAlternatives()) == 0 {
+				continue
+			}
+			seg := segment(result.GetAlternatives(), result.GetLanguageCode(), result.GetResultEndTime())
+			t := Transcript{
+				Segments:  []Segment{seg},
+				Final:     result.GetIsFinal(),
+				Stability: result.GetStability(),
+			}
+			glog.V(3).Infof("Speech recognized %q (final=%v)", t.Text(), t.Final)
+			if t.Final {
+				s.lock.Lock()
+				s.final = append(s.final, seg)
+				s.lock.Unlock()
+			}
+			select {
+			case s.Results <- t:
+			default:
+				glog.V(3).Infof("No one is reading transcripts, dropping %+v", t)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package stt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	speech "cloud.google.com/go/speech/apiv1"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc"
+)
+
+// newTestClient returns a Speech API client of a FakeServer answering with
+// transcripts.
+func newTestClient(t *testing.T, transcripts ...string) *speech.Client {
+	t.Helper()
+	fake, err := NewFakeServer(transcripts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+	client, err := speech.NewClient(context.Background(), fake.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func checkWords(t *testing.T, tr *Transcript, want string) {
+	t.Helper()
+	words := tr.Words()
+	if len(words) != len(strings.Fields(want)) {
+		t.Fatalf("got %v words, want %q", len(words), want)
+	}
+	for i, w := range words {
+		if w.Word != strings.Fields(want)[i] {
+			t.Errorf("word %v is %q, want %q", i, w.Word, strings.Fields(want)[i])
+		}
+		if w.Start != time.Duration(i)*FAKE_WORD_TIME || w.End != time.Duration(i+1)*FAKE_WORD_TIME {
+			t.Errorf("word %v spans %v-%v, want %v-%v", i, w.Start, w.End, time.Duration(i)*FAKE_WORD_TIME, time.Duration(i+1)*FAKE_WORD_TIME)
+		}
+	}
+}
+
+func TestRecognize(t *testing.T) {
+	client := newTestClient(t, "hello there", "good bye")
+	ctx := testContext(t)
+
+	for _, want := range []string{"hello there", "good bye", "hello there"} {
+		tr, err := Recognize(ctx, client, make([]byte, FAKE_BYTES_PER_WORD), Language{})
+		if err != nil {
+			t.Fatalf("Recognize: %v", err)
+		}
+		if got := tr.Text(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if !tr.Final || tr.Confidence() != 1 || tr.Language() != LANGUAGE {
+			t.Errorf("got final=%v confidence=%v language=%v, want true 1 %v", tr.Final, tr.Confidence(), tr.Language(), LANGUAGE)
+		}
+		checkWords(t, tr, want)
+	}
+}
+
+func TestStream(t *testing.T) {
+	const want = "the quick brown fox"
+	client := newTestClient(t, want)
+	stream, err := NewStream(testContext(t), client, Language{Code: "en-GB"})
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	defer stream.Cancel()
+
+	// Interim results reveal a word per FAKE_BYTES_PER_WORD.
+	chunk := make([]byte, FAKE_BYTES_PER_WORD/2)
+	words := strings.Fields(want)
+	for i := 1; i < len(words); i++ {
+		for j := 0; j < 2; j++ {
+			if err := stream.Write(chunk); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+		select {
+		case tr := <-stream.Results:
+			if tr.Final {
+				t.Fatalf("got final result %q while writing", tr.Text())
+			}
+			if got := tr.Text(); got != strings.Join(words[:i], " ") {
+				t.Errorf("interim result %v is %q, want %q", i, got, strings.Join(words[:i], " "))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no interim result %v", i)
+		}
+	}
+
+	tr, err := stream.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := tr.Text(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !tr.Final || tr.Language() != "en-GB" {
+		t.Errorf("got final=%v language=%v, want true en-GB", tr.Final, tr.Language())
+	}
+	checkWords(t, tr, want)
+
+	// The final result was published too, and then the results end.
+	var last Transcript
+	for r := range stream.Results {
+		last = r
+	}
+	if !last.Final || last.Text() != want {
+		t.Errorf("last result is %q (final=%v), want the final %q", last.Text(), last.Final, want)
+	}
+	if err := stream.Write(chunk); err == nil {
+		t.Errorf("Write after Close succeeded")
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	client := newTestClient(t, "never heard")
+	stream, err := NewStream(testContext(t), client, Language{})
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	if err := stream.Write(make([]byte, FAKE_BYTES_PER_WORD)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	stream.Cancel()
+	select {
+	case <-stream.Done():
+	default:
+		t.Fatal("stream not done after Cancel")
+	}
+	if _, err := stream.Close(); err == nil {
+		t.Errorf("Close after Cancel succeeded")
+	}
+}
+
+// hungStream is a streaming recognition that never answers until canceled.
+type hungStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s *hungStream) Send(*speechpb.StreamingRecognizeRequest) error {
+	return nil
+}
+
+func (s *hungStream) CloseSend() error {
+	return nil
+}
+
+func (s *hungStream) Recv() (*speechpb.StreamingRecognizeResponse, error) {
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func TestStreamCloseTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := newStream(&hungStream{ctx: ctx}, Language{}, cancel)
+	if err != nil {
+		t.Fatalf("newStream: %v", err)
+	}
+	stream.SetCloseTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := stream.Close(); err == nil {
+		t.Errorf("Close of a hung stream succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v, want about 100ms", d)
+	}
+}
@@ -0,0 +1,168 @@
+package stt
+
+import (
+	"strings"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	MAX_ALTERNATIVES = 3 // Alternatives requested per segment.
+)
+
+// Word is a recognized word and when it was spoken, from the start of the
+// audio.
+type Word struct {
+	Word       string
+	Start      time.Duration
+	End        time.Duration
+	Confidence float32 // 0 to 1; 0 if unknown.
+}
+
+// Alternative is one hypothesis of what was said.
+type Alternative struct {
+	Text       string
+	Confidence float32 // 0 to 1; 0 if unknown.
+	Words      []Word  // Empty if unknown, e.g. for interim results.
+}
+
+// Segment is a consecutive part of the speech.
+type Segment struct {
+	Alternatives []Alternative // Best first.
+	Language     string        // Detected language code; empty if unknown.
+	End          time.Duration // From the start of the audio.
+}
+
+// Transcript is a recognition result.
+type Transcript struct {
+	Segments  []Segment
+	Final     bool    // Later results don't revise it.
+	Stability float32 // Likelihood an interim result won't change, 0 to 1.
+}
+
+// FromText returns a final transcript of text with no details.
+func FromText(text string) *Transcript {
+	t := &Transcript{Final: true}
+	if text = strings.TrimSpace(text); text != "" {
+		t.Segments = []Segment{{Alternatives: []Alternative{{Text: text}}}}
+	}
+	return t
+}
+
+// Text returns the best alternatives joined up.
+func (t *Transcript) Text() string {
+	var txt []string
+	for _, seg := range t.Segments {
+		if len(seg.Alternatives) > 0 {
+			txt = append(txt, seg.Alternatives[0].Text)
+		}
+	}
+	return strings.Join(txt, " ")
+}
+
+// Confidence returns the mean confidence of the best alternatives, 0 if
+// unknown.
+func (t *Transcript) Confidence() float32 {
+	var sum float32
+	n := 0
+	for _, seg := range t.Segments {
+		if len(seg.Alternatives) > 0 && seg.Alternatives[0].Confidence > 0 {
+			sum += seg.Alternatives[0].Confidence
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float32(n)
+}
+
+// Words returns the words of the best alternatives.
+func (t *Transcript) Words() []Word {
+	var words []Word
+	for _, seg := range t.Segments {
+		if len(seg.Alternatives) > 0 {
+			words = append(words, seg.Alternatives[0].Words...)
+		}
+	}
+	return words
+}
+
+// Language returns the first detected language, empty if unknown.
+func (t *Transcript) Language() string {
+	for _, seg := range t.Segments {
+		if seg.Language != "" {
+			return seg.Language
+		}
+	}
+	return ""
+}
+
+// Language selects the language speech is recognized in.
+type Language struct {
+	Code   string   // BCP-47 code, e.g. "es-MX"; empty for LANGUAGE.
+	Detect []string // Other languages the speech may be in, detected automatically.
+}
+
+// recognitionConfig returns the Speech API settings for audio at SAMPLE_RATE
+// in lang.
+func recognitionConfig(lang Language) *speechpb.RecognitionConfig {
+	code := lang.Code
+	if code == "" {
+		code = LANGUAGE
+	}
+	return &speechpb.RecognitionConfig{
+		Encoding:                 speechpb.RecognitionConfig_LINEAR16,
+		SampleRateHertz:          SAMPLE_RATE,
+		LanguageCode:             code,
+		AlternativeLanguageCodes: lang.Detect,
+		MaxAlternatives:          MAX_ALTERNATIVES,
+		EnableWordTimeOffsets:    true,
+		EnableWordConfidence:     true,
+	}
+}
+
+// segment converts the alternatives of a Speech API result.
+func segment(alts []*speechpb.SpeechRecognitionAlternative, language string, end *durationpb.Duration) Segment {
+	seg := Segment{
+		Language: language,
+		End:      duration(end),
+	}
+	for _, alt := range alts {
+		a := Alternative{
+			Text:       strings.TrimSpace(alt.GetTranscript()),
+			Confidence: alt.GetConfidence(),
+		}
+		for _, w := range alt.GetWords() {
+			a.Words = append(a.Words, Word{
+				Word:       w.GetWord(),
+				Start:      duration(w.GetStartTime()),
+				End:        duration(w.GetEndTime()),
+				Confidence: w.GetConfidence(),
+			})
+		}
+		seg.Alternatives = append(seg.Alternatives, a)
+	}
+	return seg
+}
+
+// fromResponse converts a batch Speech API response, nil for none.
+func fromResponse(resp *speechpb.RecognizeResponse) *Transcript {
+	t := &Transcript{Final: true}
+	for _, result := range resp.GetResults() {
+		if len(result.GetAlternatives()) == 0 {
+			continue
+		}
+		t.Segments = append(t.Segments, segment(result.GetAlternatives(), result.GetLanguageCode(), result.GetResultEndTime()))
+	}
+	return t
+}
+
+func duration(d *durationpb.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.AsDuration()
+}
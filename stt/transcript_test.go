@@ -0,0 +1,107 @@
+package stt
+
+import (
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestFromText(t *testing.T) {
+	tr := FromText("  hello there ")
+	if tr.Text() != "hello there" || !tr.Final || tr.Confidence() != 0 || tr.Words() != nil || tr.Language() != "" {
+		t.Errorf("got %+v", tr)
+	}
+	if tr := FromText(" "); len(tr.Segments) != 0 || tr.Text() != "" {
+		t.Errorf("got %+v from no text", tr)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	tr := &Transcript{Segments: []Segment{
+		{Alternatives: []Alternative{
+			{Text: "recognize speech", Confidence: 0.9, Words: []Word{{Word: "recognize"}, {Word: "speech"}}},
+			{Text: "wreck a nice beach", Confidence: 0.4},
+		}},
+		{}, // No alternatives.
+		{Language: "es-mx", Alternatives: []Alternative{{Text: "hola"}}},
+		{Language: "en-us", Alternatives: []Alternative{{Text: "bye", Confidence: 0.5, Words: []Word{{Word: "bye"}}}}},
+	}}
+	if got := tr.Text(); got != "recognize speech hola bye" {
+		t.Errorf("got text %q", got)
+	}
+	// Segments without a confidence don't count.
+	if got := tr.Confidence(); got != 0.7 {
+		t.Errorf("got confidence %v, want 0.7", got)
+	}
+	words := tr.Words()
+	if len(words) != 3 || words[0].Word != "recognize" || words[2].Word != "bye" {
+		t.Errorf("got words %+v", words)
+	}
+	if got := tr.Language(); got != "es-mx" {
+		t.Errorf("got language %q, want es-mx", got)
+	}
+}
+
+func TestFromResponse(t *testing.T) {
+	if tr := fromResponse(nil); !tr.Final || len(tr.Segments) != 0 {
+		t.Errorf("got %+v from no response", tr)
+	}
+
+	tr := fromResponse(&speechpb.RecognizeResponse{Results: []*speechpb.SpeechRecognitionResult{
+		nil,
+		{LanguageCode: "fr-fr"}, // No alternatives.
+		{
+			LanguageCode:  "en-us",
+			ResultEndTime: durationpb.New(2 * time.Second),
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{
+				{
+					Transcript: " hello world",
+					Confidence: 0.8,
+					Words: []*speechpb.WordInfo{
+						{Word: "hello", StartTime: durationpb.New(0), EndTime: durationpb.New(time.Second), Confidence: 0.9},
+						{Word: "world", EndTime: durationpb.New(2 * time.Second)},
+						nil,
+					},
+				},
+				{Transcript: "hollow world", Confidence: 0.1},
+			},
+		},
+	}})
+	if len(tr.Segments) != 1 {
+		t.Fatalf("got %v segments, want 1", len(tr.Segments))
+	}
+	seg := tr.Segments[0]
+	if seg.Language != "en-us" || seg.End != 2*time.Second || len(seg.Alternatives) != 2 {
+		t.Errorf("got segment %+v", seg)
+	}
+	if tr.Text() != "hello world" || tr.Confidence() != 0.8 || seg.Alternatives[1].Text != "hollow world" {
+		t.Errorf("got %q with confidence %v, and alternative %q", tr.Text(), tr.Confidence(), seg.Alternatives[1].Text)
+	}
+	want := []Word{
+		{Word: "hello", End: time.Second, Confidence: 0.9},
+		{Word: "world", End: 2 * time.Second},
+		{},
+	}
+	words := tr.Words()
+	if len(words) != len(want) {
+		t.Fatalf("got words %+v, want %+v", words, want)
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Errorf("word %v is %+v, want %+v", i, words[i], want[i])
+		}
+	}
+}
+
+func TestRecognitionConfig(t *testing.T) {
+	c := recognitionConfig(Language{})
+	if c.LanguageCode != LANGUAGE || len(c.AlternativeLanguageCodes) != 0 || c.MaxAlternatives != MAX_ALTERNATIVES {
+		t.Errorf("got %+v for the default language", c)
+	}
+	c = recognitionConfig(Language{Code: "es-MX", Detect: []string{"en-US"}})
+	if c.LanguageCode != "es-MX" || len(c.AlternativeLanguageCodes) != 1 || c.AlternativeLanguageCodes[0] != "en-US" {
+		t.Errorf("got %+v for es-MX detecting en-US", c)
+	}
+}
@@ -0,0 +1,159 @@
+/* Package tts speaks text with a pluggable speech synthesizer.
+*
+* Rendered phrases are cached on disk as WAV files keyed by the text, the
+* synthesizer voice and the voice effect settings, so repeated phrases play
+* without synthesizing them again.
+ */
+package tts
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+// Synthesizer renders text to speech.
+type Synthesizer interface {
+	Synthesize(text string) ([]int16, audio.Format, error)
+	// Voice identifies the voice and its settings, for caching.
+	Voice() string
+}
+
+// Flite synthesizes with the flite command line tool.
+type Flite struct {
+	voice string
+}
+
+// NewFlite returns a Flite speaking with voice, e.g. "slt".
+func NewFlite(voice string) *Flite {
+	return &Flite{voice: voice}
+}
+
+func (s *Flite) Synthesize(text string) ([]int16, audio.Format, error) {
+	fh, err := ioutil.TempFile("", "walle-tts-*.wav")
+	if err != nil {
+		return nil, audio.Format{}, err
+	}
+	fh.Close()
+	defer os.Remove(fh.Name())
+
+	out, err := exec.Command("flite", "-voice", s.voice, "-t", text, "-o", fh.Name()).CombinedOutput()
+	if err != nil {
+		return nil, audio.Format{}, fmt.Errorf("flite failed: %v: %s", err, out)
+	}
+	return audio.ReadWAVFile(fh.Name())
+}
+
+func (s *Flite) Voice() string {
+	return "flite/" + s.voice
+}
+
+// Speaker says text on an Audio.
+type Speaker struct {
+	audio *audio.Audio
+	synth Synthesizer
+	dir   string // Phrase cache; empty to not cache.
+}
+
+// NewSpeaker returns a Speaker synthesizing with synth and caching phrases in
+// dir, which is created if needed. An empty dir disables the cache.
+func NewSpeaker(a *audio.Audio, synth Synthesizer, dir string) (*Speaker, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Speaker{
+		audio: a,
+		synth: synth,
+		dir:   dir,
+	}, nil
+}
+
+// Say queues text on the speech channel and returns its playback session.
+func (s *Speaker) Say(text string) (*audio.Session, error) {
+	voice := s.audio.GetVoice()
+	samples, err := s.Render(text, voice)
+	if err != nil {
+		return nil, err
+	}
+
+	// The effects are rendered in already.
+	session := s.audio.NewSession()
+	session.DisableVoice()
+	go func() {
+		session.PlaySamples(samples)
+		session.End()
+	}()
+	return session, nil
+}
+
+// Render returns text as speech in audio.DEFAULT_FORMAT, run through voice if
+// enabled.
+func (s *Speaker) Render(text string, voice audio.VoiceConfig) ([]int16, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	fname := s.cacheFile(text, voice)
+	if fname != "" {
+		if samples, _, err := audio.ReadWAVFile(fname); err == nil {
+			glog.V(3).Infof("Phrase %q cached in %v", text, fname)
+			return samples, nil
+		}
+	}
+
+	samples, f, err := s.synth.Synthesize(text)
+	if err != nil {
+		return nil, err
+	}
+	samples = audio.Convert(samples, f, audio.DEFAULT_FORMAT)
+	if voice.Enabled {
+		v := audio.NewVoice(voice)
+		samples = append(v.Process(samples), v.Flush()...)
+	}
+	glog.V(2).Infof("Synthesized phrase %q (%v samples)", text, len(samples))
+
+	if fname != "" {
+		if err := writeCache(fname, samples); err != nil {
+			glog.Warningf("Failed to cache phrase %q: %v", text, err)
+		}
+	}
+	return samples, nil
+}
+
+// cacheFile returns the cache file of text, empty if not caching.
+func (s *Speaker) cacheFile(text string, voice audio.VoiceConfig) string {
+	if s.dir == "" {
+		return ""
+	}
+	effects := "none"
+	if voice.Enabled {
+		effects = fmt.Sprintf("%+v", voice)
+	}
+	sum := sha1.Sum([]byte(s.synth.Voice() + "\x00" + effects + "\x00" + text))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".wav")
+}
+
+// writeCache saves samples to fname, via a temporary file so a partly
+// written phrase is never read.
+func writeCache(fname string, samples []int16) error {
+	fh, err := ioutil.TempFile(filepath.Dir(fname), ".phrase-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	if err := audio.WriteWAV(fh, samples, audio.DEFAULT_FORMAT); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fh.Name(), fname)
+}
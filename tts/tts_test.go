@@ -0,0 +1,137 @@
+package tts
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/deepakkamesh/walle/audio"
+)
+
+// fakeSynth speaks a tone as long as the text, counting the calls.
+type fakeSynth struct {
+	voice string
+	calls int
+	err   error
+}
+
+func (s *fakeSynth) Synthesize(text string) ([]int16, audio.Format, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, audio.Format{}, s.err
+	}
+	f := audio.Format{Rate: 8000, Channels: 1}
+	samples := make([]int16, 80*len(text))
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*200*float64(i)/8000))
+	}
+	return samples, f, nil
+}
+
+func (s *fakeSynth) Voice() string {
+	return s.voice
+}
+
+func render(t *testing.T, s *Speaker, text string, voice audio.VoiceConfig) []int16 {
+	t.Helper()
+	samples, err := s.Render(text, voice)
+	if err != nil {
+		t.Fatalf("Render(%q): %v", text, err)
+	}
+	if len(samples) == 0 {
+		t.Fatalf("Render(%q) is silent", text)
+	}
+	return samples
+}
+
+func newSpeaker(t *testing.T, synth Synthesizer, dir string) *Speaker {
+	t.Helper()
+	s, err := NewSpeaker(nil, synth, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRenderCache(t *testing.T) {
+	synth := &fakeSynth{voice: "fake/a"}
+	s := newSpeaker(t, synth, t.TempDir())
+	plain := audio.VoiceConfig{}
+	robot := audio.DefaultVoiceConfig()
+	robot.Enabled = true
+
+	first := render(t, s, "hello there", plain)
+	// Resampled from 8kHz.
+	if len(first) != 2*80*len("hello there") {
+		t.Errorf("got %v samples, want %v", len(first), 2*80*len("hello there"))
+	}
+	// Cached, with the spacing normalized.
+	if again := render(t, s, "  hello\tthere ", plain); synth.calls != 1 || len(again) != len(first) {
+		t.Errorf("synthesized %v times, want the cached phrase", synth.calls)
+	}
+	// Effects settings are ignored while disabled.
+	disabled := robot
+	disabled.Enabled = false
+	if render(t, s, "hello there", disabled); synth.calls != 1 {
+		t.Errorf("synthesized %v times, want the cached phrase", synth.calls)
+	}
+
+	// Different effects, voice or text miss the cache.
+	if render(t, s, "hello there", robot); synth.calls != 2 {
+		t.Errorf("synthesized %v times, want 2 with effects", synth.calls)
+	}
+	robot.Pitch++
+	if render(t, s, "hello there", robot); synth.calls != 3 {
+		t.Errorf("synthesized %v times, want 3 with other effects", synth.calls)
+	}
+	synth.voice = "fake/b"
+	if render(t, s, "hello there", plain); synth.calls != 4 {
+		t.Errorf("synthesized %v times, want 4 with another voice", synth.calls)
+	}
+	if render(t, s, "hello", plain); synth.calls != 5 {
+		t.Errorf("synthesized %v times, want 5 for other text", synth.calls)
+	}
+	// All of those are cached now.
+	render(t, s, "hello", plain)
+	synth.voice = "fake/a"
+	robot.Pitch--
+	render(t, s, "hello there", robot)
+	if synth.calls != 5 {
+		t.Errorf("synthesized %v times, want the cached phrases", synth.calls)
+	}
+}
+
+func TestRenderCorruptCache(t *testing.T) {
+	synth := &fakeSynth{voice: "fake"}
+	s := newSpeaker(t, synth, t.TempDir())
+	want := render(t, s, "hi", audio.VoiceConfig{})
+
+	fname := s.cacheFile("hi", audio.VoiceConfig{})
+	if err := ioutil.WriteFile(fname, []byte("RIFF garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(t, s, "hi", audio.VoiceConfig{}); synth.calls != 2 || len(got) != len(want) {
+		t.Errorf("got %v samples after %v calls, want %v synthesized again", len(got), synth.calls, len(want))
+	}
+	// The cache was repaired.
+	render(t, s, "hi", audio.VoiceConfig{})
+	if synth.calls != 2 {
+		t.Errorf("synthesized %v times, want the repaired cache used", synth.calls)
+	}
+}
+
+func TestRenderNoCache(t *testing.T) {
+	synth := &fakeSynth{voice: "fake"}
+	s := newSpeaker(t, synth, "")
+	render(t, s, "hi", audio.VoiceConfig{})
+	render(t, s, "hi", audio.VoiceConfig{})
+	if synth.calls != 2 {
+		t.Errorf("synthesized %v times without a cache, want 2", synth.calls)
+	}
+
+	synth.err = errors.New("no voice")
+	if _, err := s.Render("hi", audio.VoiceConfig{}); err != synth.err {
+		t.Errorf("got error %v, want %v", err, synth.err)
+	}
+}
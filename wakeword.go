@@ -0,0 +1,74 @@
+package walle
+
+import (
+	"github.com/deepakkamesh/walle/audio"
+	"github.com/golang/glog"
+)
+
+// startHotword listens on the mic for the hotword until it is heard or
+// stopHotword is called. A detection is signalled on hotwordCh.
+func (s *WallE) startHotword() {
+	if s.hotword == nil || s.hotwordDone != nil {
+		return
+	}
+	s.hotword.Reset()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.hotwordStop = stop
+	s.hotwordDone = done
+
+	s.audio.StartListen()
+	go func() {
+		defer close(done)
+		defer func() {
+			s.audio.StopListen()
+			s.audio.DrainIn()
+		}()
+
+		for {
+			select {
+			case <-stop:
+				return
+
+			case buff := <-s.audio.In:
+				if s.hotword.Process(audio.BytesToSamples(buff.Bytes())) {
+					select {
+					case s.hotwordCh <- struct{}{}:
+					default:
+					}
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopHotword stops listening for the hotword and releases the mic.
+func (s *WallE) stopHotword() {
+	if s.hotwordDone == nil {
+		return
+	}
+	close(s.hotwordStop)
+	<-s.hotwordDone
+	s.hotwordDone = nil
+	glog.V(3).Info("Stopped listening for hotword")
+}
+
+// converse runs interactAI with the mic handed over from the hotword
+// spotter, and resumes spotting afterwards. A reply the user interrupts is
+// followed by a new conversation.
+func (s *WallE) converse() {
+	if s.audioDegraded() {
+		glog.Warningf("Audio is down, not starting a conversation")
+		if err := s.emotion.Expression(EMOTION_DEGRADED, CH, 300); err != nil {
+			glog.Warningf("Failed to display emotion: %v", err)
+		}
+		return
+	}
+	s.stopHotword()
+	for s.interactAI() {
+		glog.V(1).Info("Reply interrupted, starting a new conversation")
+	}
+	glog.V(2).Infof("Audio stats: %+v", s.audio.Stats())
+	s.startHotword()
+}
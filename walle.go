@@ -1,7 +1,9 @@
 package walle
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"gobot.io/x/gobot"
@@ -11,40 +13,102 @@ import (
 
 	"github.com/deepakkamesh/walle/assistant"
 	"github.com/deepakkamesh/walle/audio"
+	"github.com/deepakkamesh/walle/hotword"
+	"github.com/deepakkamesh/walle/recorder"
+	"github.com/deepakkamesh/walle/sfx"
+	"github.com/deepakkamesh/walle/stt"
+	"github.com/deepakkamesh/walle/tts"
 	"github.com/golang/glog"
 	termbox "github.com/nsf/termbox-go"
+	"google.golang.org/api/option"
 )
 
 const (
 	CH1            = '█'
 	CH             = '▒'
 	SLEEPY_TIMEOUT = 60
+	SLEEPY_VOLUME  = 40 // Percent of the normal volume WallE mumbles at when bored.
+	VOLUME         = 70 // Default volume percent.
+	VOLUME_STEP    = 10
+	MIN_CONFIDENCE = 0.5 // Reply transcripts recognized with less are ignored.
 )
 
 type WallEConfig struct {
-	SecretsFile    string
-	AssistantScope string
-	ResourcePath   string
-	BtnPort        string
-	IRPort         string
+	SecretsFile       string
+	AssistantScope    string
+	ResourcePath      string
+	BtnPort           string
+	IRPort            string
+	VoiceGate         bool          // Stop streaming mic audio to the assistant when the user stops talking.
+	BargeIn           bool          // Let the user interrupt replies by talking; the button always can.
+	Sounds            bool          // Pair emotion changes with sound effects.
+	LipSyncWords      bool          // Move the mouth with the word timings of transcribed replies rather than their loudness.
+	Volume            *int          // Initial volume percent; nil for VOLUME.
+	AudioIn           audio.Format  // Mic device format; zero for audio.DEFAULT_FORMAT.
+	AudioOut          audio.Format  // Speaker device format; zero for audio.DEFAULT_FORMAT.
+	AudioInDevice     string        // Mic device name or index; empty for the default.
+	AudioOutDevice    string        // Speaker device name or index; empty for the default.
+	AudioInLatency    time.Duration // Suggested mic latency; 0 for the device default.
+	AudioOutLatency   time.Duration // Suggested speaker latency; 0 for the device default.
+	AudioBackend      audio.Backend // Audio devices, e.g. files to run headless; nil for PortAudio with the settings above.
+	Hotword           hotword.Config
+	Recorder          recorder.Config   // Session recording; empty Dir disables it.
+	AGC               *audio.AGCConfig  // Mic gain control; nil for the saved settings of the mic.
+	AGCFile           string            // File in the resource folder saving AGC settings per mic; empty to not save.
+	Voice             audio.VoiceConfig // Effect chain on speech playback.
+	Recognizer        string            // Speech recognizer, one of RECOGNIZER_*; empty for Google.
+	OfflineSTT        string            // Command line of the offline recognizer, also the fallback of Google; empty for none.
+	FakeSTT           []string          // Scripted transcripts of the fake recognizer, or of a local fake Speech API for Google.
+	Language          string            // BCP-47 code of speech recognition and sentiment, e.g. "es-MX"; empty for en-US. The Assistant speaks the language of its device settings.
+	DetectLanguages   []string          // Other languages replies may be in, detected automatically.
+	KeywordsFile      string            // JSON file in the resource folder of keyword tables per language (see LoadKeywords); empty for the built in tables.
+	APITimeout        time.Duration     // Limit of each cloud API call; 0 for API_TIMEOUT.
+	Sentiment         string            // Sentiment analyzer, one of SENTIMENT_*; empty for Google.
+	SentimentFallback bool              // Fall back to the lexicon when Google fails.
+	LexiconFile       string            // AFINN file in the resource folder of words added to the built in lexicon (see LoadLexicon); empty for none.
+	TTSVoice          string            // Flite voice speaking Say.
+	TTSCache          string            // Folder in the resource folder caching spoken phrases; empty to not cache.
 }
 
 type WallE struct {
-	audio      *audio.Audio
-	gAssistant *assistant.GAssistant // Google Assistant object.
-	emotion    *Emotion
-	btnChan    chan *gobot.Event
-	irChan     chan *gobot.Event
-	resPath    string
+	audio        *audio.Audio
+	gAssistant   *assistant.GAssistant // Google Assistant object.
+	emotion      *Emotion
+	btnChan      chan *gobot.Event
+	irChan       chan *gobot.Event
+	resPath      string
+	recorder     *recorder.Recorder // nil if not recording.
+	bargeIn      bool
+	lipSyncWords bool
+	audioDown    [2]bool // By audio direction; streams down.
+
+	sounds      *sfx.Player
+	agcSettings *audio.AGCSettings // nil if not saved.
+	agcDevice   string             // Mic the AGC settings are saved for.
+
+	recognizer Recognizer       // Transcribes replies once complete.
+	streamer   StreamRecognizer // Transcribes replies as they arrive; nil if not streaming.
+	fakeSTT    *stt.FakeServer  // nil unless faking the Speech API.
+	clients    *Clients
+	speaker    *tts.Speaker
+	language   string   // BCP-47 code replies are expected in.
+	keywords   Keywords // Words overriding the sentiment, by language.
+	sentiment  SentimentAnalyzer
+
+	// Offline hotword spotting; nil hotword if not configured.
+	hotword     *hotword.Detector
+	hotwordCh   chan struct{}
+	hotwordStop chan struct{}
+	hotwordDone chan struct{}
 }
 
 // New returns a new initialized WallE object.
 func New() *WallE {
 
 	return &WallE{
-		audio:      audio.New(),
 		gAssistant: assistant.New(),
 		emotion:    NewEmotion(),
+		hotwordCh:  make(chan struct{}, 1),
 	}
 }
 
@@ -52,13 +116,154 @@ func New() *WallE {
 func (s *WallE) Init(c *WallEConfig) error {
 
 	s.resPath = c.ResourcePath
+	s.bargeIn = c.BargeIn
+	s.lipSyncWords = c.LipSyncWords
 
 	// Initialize Audio.
+	backend := c.AudioBackend
+	if backend == nil {
+		pa := audio.NewPortAudio()
+		if c.AudioIn.Rate > 0 {
+			pa.InFormat = c.AudioIn
+		}
+		if c.AudioOut.Rate > 0 {
+			pa.OutFormat = c.AudioOut
+		}
+		pa.InDevice = c.AudioInDevice
+		pa.OutDevice = c.AudioOutDevice
+		pa.InLatency = c.AudioInLatency
+		pa.OutLatency = c.AudioOutLatency
+		backend = pa
+	}
+	s.audio = audio.NewWithBackend(backend)
 	if err := s.audio.Init(); err != nil {
 		return err
 	}
+	volume := VOLUME
+	if c.Volume != nil {
+		volume = *c.Volume
+	}
+	s.audio.SetVolume(volume)
 	s.audio.StartPlayback()
 
+	// Mic gain control, remembered per mic.
+	if pa, ok := backend.(*audio.PortAudio); ok {
+		s.agcDevice = pa.InputName()
+	}
+	if s.agcDevice == "" {
+		s.agcDevice = c.AudioInDevice
+	}
+	if s.agcDevice == "" {
+		s.agcDevice = "default"
+	}
+	agc := audio.DefaultAGCConfig()
+	if c.AGCFile != "" {
+		settings, err := audio.LoadAGCSettings(fmt.Sprintf("%v/%v", c.ResourcePath, c.AGCFile))
+		if err != nil {
+			return fmt.Errorf("failed to load AGC settings: %v", err)
+		}
+		s.agcSettings = settings
+		if saved, ok := settings.Get(s.agcDevice); ok {
+			agc = saved
+		}
+	}
+	if c.AGC != nil {
+		agc = *c.AGC
+		s.saveAGC(agc)
+	}
+	s.audio.SetAGC(agc)
+
+	// Robot voice on speech.
+	s.audio.SetVoice(c.Voice)
+
+	// Sound effects.
+	s.sounds = sfx.NewPlayer(s.audio)
+	if c.Sounds {
+		s.emotion.SetSounds(s.sounds)
+	}
+
+	// Speech synthesis, caching phrases.
+	cache := ""
+	if c.TTSCache != "" {
+		cache = fmt.Sprintf("%v/%v", c.ResourcePath, c.TTSCache)
+	}
+	speaker, err := tts.NewSpeaker(s.audio, tts.NewFlite(c.TTSVoice), cache)
+	if err != nil {
+		return fmt.Errorf("failed to init speech synthesis: %v", err)
+	}
+	s.speaker = speaker
+
+	// Language of replies.
+	s.language = c.Language
+	if s.language == "" {
+		s.language = stt.LANGUAGE
+	}
+	s.keywords = KEYWORDS
+	if c.KeywordsFile != "" {
+		keywords, err := LoadKeywords(fmt.Sprintf("%v/%v", c.ResourcePath, c.KeywordsFile))
+		if err != nil {
+			return fmt.Errorf("failed to load keywords: %v", err)
+		}
+		s.keywords = keywords
+	}
+
+	// Cloud API clients, shared by all calls.
+	var opts []option.ClientOption
+	if len(c.FakeSTT) > 0 && (c.Recognizer == RECOGNIZER_GOOGLE || c.Recognizer == "") {
+		fake, err := stt.NewFakeServer(c.FakeSTT...)
+		if err != nil {
+			return fmt.Errorf("failed to start fake speech server: %v", err)
+		}
+		s.fakeSTT = fake
+		opts = fake.Options()
+	}
+	s.clients = NewClients(c.APITimeout, opts...)
+
+	// Speech recognition, falling back to the offline engine.
+	var offline Recognizer
+	if c.OfflineSTT != "" {
+		offline = NewOfflineRecognizer(c.OfflineSTT)
+	}
+	switch c.Recognizer {
+	case RECOGNIZER_GOOGLE, "":
+		google := NewGoogleRecognizer(stt.Language{Code: c.Language, Detect: c.DetectLanguages}, s.clients)
+		s.recognizer = google
+		s.streamer = google
+		if offline != nil {
+			s.recognizer = &fallbackRecognizer{primary: google, fallback: offline}
+		}
+	case RECOGNIZER_OFFLINE:
+		if offline == nil {
+			return errors.New("offline speech recognition needs a command")
+		}
+		s.recognizer = offline
+	case RECOGNIZER_FAKE:
+		s.recognizer = NewFakeRecognizer(c.FakeSTT...)
+	default:
+		return fmt.Errorf("unknown speech recognizer %v", c.Recognizer)
+	}
+
+	// Sentiment analysis, falling back to the lexicon.
+	lexicon := LEXICON
+	if c.LexiconFile != "" {
+		l, err := LoadLexicon(fmt.Sprintf("%v/%v", c.ResourcePath, c.LexiconFile))
+		if err != nil {
+			return fmt.Errorf("failed to load lexicon: %v", err)
+		}
+		lexicon = l
+	}
+	switch c.Sentiment {
+	case SENTIMENT_GOOGLE, "":
+		s.sentiment = NewGoogleSentiment(s.clients)
+		if c.SentimentFallback {
+			s.sentiment = &fallbackSentiment{primary: s.sentiment, fallback: NewLexiconSentiment(lexicon)}
+		}
+	case SENTIMENT_LEXICON:
+		s.sentiment = NewLexiconSentiment(lexicon)
+	default:
+		return fmt.Errorf("unknown sentiment analyzer %v", c.Sentiment)
+	}
+
 	// Initialize Google Assistant.
 	if err := s.gAssistant.Init(s.audio, fmt.Sprintf("%v/%v", c.ResourcePath, c.SecretsFile), c.AssistantScope); err != nil {
 		return err
@@ -66,6 +271,30 @@ func (s *WallE) Init(c *WallEConfig) error {
 	if err := s.gAssistant.Auth(); err != nil {
 		return err
 	}
+	s.gAssistant.SetVoiceGate(c.VoiceGate)
+
+	// Initialize session recorder.
+	r, err := recorder.New(c.Recorder)
+	if err != nil {
+		return err
+	}
+	s.recorder = r
+
+	// Initialize hotword spotter.
+	if len(c.Hotword.Templates) > 0 {
+		templates := make([]string, len(c.Hotword.Templates))
+		for i, t := range c.Hotword.Templates {
+			templates[i] = fmt.Sprintf("%v/%v", c.ResourcePath, t)
+		}
+		d, err := hotword.NewFromConfig(hotword.Config{
+			Templates: templates,
+			Threshold: c.Hotword.Threshold,
+		})
+		if err != nil {
+			return err
+		}
+		s.hotword = d
+	}
 
 	// Initialize Pi Adapter.
 	rpi := raspi.NewAdaptor()
@@ -98,6 +327,7 @@ func (s *WallE) Init(c *WallEConfig) error {
 // Run is the main event loop.
 func (s *WallE) Run() {
 	sleepyTimer := time.NewTimer(SLEEPY_TIMEOUT * time.Second)
+	s.startHotword()
 
 	for {
 		select {
@@ -106,18 +336,53 @@ func (s *WallE) Run() {
 			if evt.Type == termbox.EventKey {
 				switch {
 				case evt.Key == termbox.KeyEsc:
+					s.stopHotword()
 					s.emotion.Quit()
 					s.audio.Quit()
+					s.clients.Close()
+					if s.fakeSTT != nil {
+						s.fakeSTT.Close()
+					}
 					return
 
 				case evt.Ch == 'r':
-					s.interactAI()
+					s.converse()
 
 				case evt.Ch == 't':
 					s.emotion.CycleEmotions()
 
 				case evt.Ch == 's':
 					TextToSpeech(s.resPath+"/bored.raw", s.audio)
+
+				case evt.Ch == 'c':
+					if err := s.Say(time.Now().Format("It is 3 04 PM")); err != nil {
+						glog.Warningf("Failed to say the time: %v", err)
+					}
+
+				case evt.Ch == 'e':
+					s.cycleSounds()
+
+				case evt.Ch == 'm':
+					s.audio.Mute(!s.audio.Muted())
+
+				case evt.Ch == 'a':
+					agc := s.audio.GetAGC()
+					agc.Enabled = !agc.Enabled
+					glog.V(1).Infof("Mic AGC enabled: %v", agc.Enabled)
+					s.audio.SetAGC(agc)
+					s.saveAGC(agc)
+
+				case evt.Ch == 'v':
+					voice := s.audio.GetVoice()
+					voice.Enabled = !voice.Enabled
+					glog.V(1).Infof("Robot voice enabled: %v", voice.Enabled)
+					s.audio.SetVoice(voice)
+
+				case evt.Ch == '+':
+					s.audio.SetVolume(s.audio.GetVolume() + VOLUME_STEP)
+
+				case evt.Ch == '-':
+					s.audio.SetVolume(s.audio.GetVolume() - VOLUME_STEP)
 				}
 			}
 
@@ -126,7 +391,7 @@ func (s *WallE) Run() {
 			if evt.Name == "push" {
 				sleepyTimer.Stop()
 				sleepyTimer.Reset((SLEEPY_TIMEOUT + 20) * time.Second) // Another 20s to account for interaction.
-				s.interactAI()
+				s.converse()
 			}
 
 		case evt := <-s.irChan:
@@ -135,78 +400,331 @@ func (s *WallE) Run() {
 				sleepyTimer.Stop()
 				sleepyTimer.Reset((SLEEPY_TIMEOUT + 20) * time.Second)
 				s.emotion.Expression(EMOTION_NORM, CH, 500)
-				s.interactAI()
+				s.converse()
 			}
 
+		case e := <-s.audio.Events:
+			s.audioEvent(e)
+
+		case <-s.hotwordCh:
+			glog.V(2).Infof("Heard hotword")
+			sleepyTimer.Stop()
+			sleepyTimer.Reset((SLEEPY_TIMEOUT + 20) * time.Second)
+			s.converse()
+
 		case <-sleepyTimer.C:
 			glog.V(3).Info("Sleepy timer expired.")
 			if err := s.emotion.Expression(EMOTION_SLEEPY, CH, 500); err != nil {
 				glog.Warningf("Failed to display emotion: %v", err)
 			}
+			// Mumble, drifting off quieter.
+			vol := s.audio.GetVolume()
+			s.audio.Fade(vol*SLEEPY_VOLUME/100, time.Second)
 			TextToSpeech(s.resPath+"/bored.raw", s.audio)
+			s.audio.SetVolume(vol)
 		}
 	}
 	return
 }
 
+// cycleSounds plays each sound effect in turn; primarily a test function.
+func (s *WallE) cycleSounds() {
+	for _, name := range s.sounds.Names() {
+		glog.V(2).Infof("Playing sound effect %v", name)
+		session, err := s.sounds.Play(name)
+		if err != nil {
+			glog.Warningf("Failed to play sound effect: %v", err)
+			continue
+		}
+		session.Wait()
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// saveAGC remembers the AGC settings for the mic.
+func (s *WallE) saveAGC(c audio.AGCConfig) {
+	if s.agcSettings == nil {
+		return
+	}
+	if err := s.agcSettings.Set(s.agcDevice, c); err != nil {
+		glog.Warningf("Failed to save AGC settings: %v", err)
+	}
+}
+
+// audioEvent shows a degraded expression while an audio stream is down.
+func (s *WallE) audioEvent(e audio.Event) {
+	s.audioDown[e.Dir] = e.Type == audio.AUDIO_FAILED
+	if s.audioDegraded() {
+		glog.Warningf("Audio degraded: %v", e.Err)
+		if err := s.emotion.Expression(EMOTION_DEGRADED, CH, 300); err != nil {
+			glog.Warningf("Failed to display emotion: %v", err)
+		}
+		return
+	}
+	glog.Info("Audio recovered")
+	if err := s.emotion.Expression(EMOTION_NORM, CH, 500); err != nil {
+		glog.Warningf("Failed to display emotion: %v", err)
+	}
+}
+
+// audioDegraded returns true if the mic or speaker is down.
+func (s *WallE) audioDegraded() bool {
+	return s.audioDown[audio.DIR_IN] || s.audioDown[audio.DIR_OUT]
+}
+
+// interrupted returns true if barged is closed.
+func interrupted(barged <-chan struct{}) bool {
+	select {
+	case <-barged:
+		return true
+	default:
+		return false
+	}
+}
+
+// startLipSync syncs the mouth to the speaker. The returned func stops it and
+// may be called more than once.
+func (s *WallE) startLipSync() func() {
+	levels := s.audio.SubscribeLevels()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.emotion.LipSync(levels, done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			s.audio.UnsubscribeLevels(levels)
+		})
+	}
+}
+
+// transcribe returns the transcript of the reply audio data, streamed to
+// transcriber as it arrived.
+func (s *WallE) transcribe(transcriber *replyTranscriber, data []byte) (*stt.Transcript, error) {
+	tr, ok, err := transcriber.Close()
+	if ok && err == nil {
+		return tr, nil
+	}
+	if err != nil {
+		glog.Warningf("Streaming speech recognition failed: %v", err)
+	}
+	return s.recognizer.Recognize(data)
+}
+
+// startWordSync moves the mouth with words of audio that started playing at
+// start. The returned func stops it and may be called more than once.
+func (s *WallE) startWordSync(words []stt.Word, start time.Time) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.emotion.WordSync(words, start, done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
 // interactAI runs a gAssistant session collects the response text
 // and analyzes it for sentiment.
-func (s *WallE) interactAI() {
+// It returns true if the user interrupted the reply.
+func (s *WallE) interactAI() bool {
 
 	//TODO: ResetPlayback() is workaround for Pi as the audio does not continue playing after
 	// first interaction. Needs investigation and fix.
 	s.audio.ResetPlayback()
 
+	// Record the session if enabled.
+	var taps assistant.Taps
+	rec := s.recorder.Start()
+	defer rec.Close()
+	if rec != nil {
+		taps = append(taps, rec)
+	}
+
+	// Transcribe the reply while it arrives.
+	transcriber := &replyTranscriber{
+		recognizer: s.streamer,
+		sentiment:  s.sentiment,
+		language:   s.language,
+	}
+	defer transcriber.Cancel()
+	taps = append(taps, transcriber)
+
+	s.gAssistant.SetTap(taps)
+	defer s.gAssistant.SetTap(nil)
+
+	// Move the mouth with the reply.
+	stopLipSync := s.startLipSync()
+	defer func() { stopLipSync() }()
+
+	// Show the user that WallE hears them while they talk. Voice activity from
+	// before the conversation is stale.
+	s.audio.DrainVoice()
+	listenDone := make(chan struct{})
+	listenStopped := make(chan struct{})
+	var listenOnce sync.Once
+	stopListening := func() {
+		listenOnce.Do(func() { close(listenDone) })
+		<-listenStopped
+	}
 	go func() {
-		st := <-s.gAssistant.StatusCh
-		if st == embedded.ConverseResponse_END_OF_UTTERANCE {
-			glog.V(2).Infof("gAssisant sent END_OF_UTTERANCE")
-			if err := s.emotion.Expression(EMOTION_SPEAK, CH, 100); err != nil {
-				glog.Warningf("Failed to display emotion: %v", err)
+		defer close(listenStopped)
+		for {
+			select {
+			case <-listenDone:
+				return
+			case e := <-s.audio.VoiceCh:
+				emotion := EMOTION_BLINK
+				if e.Type == audio.VAD_SPEECH_START {
+					emotion = EMOTION_LISTEN
+				}
+				if err := s.emotion.Expression(emotion, CH, 100); err != nil {
+					glog.Warningf("Failed to display emotion: %v", err)
+				}
 			}
 		}
 	}()
 
+	// Once the user stopped talking WallE replies, and can be interrupted.
+	select {
+	case <-s.gAssistant.StatusCh: // Stale.
+	default:
+	}
+	done := make(chan struct{})
+	barged := make(chan struct{})
+	watchDone := make(chan struct{})
+	defer func() {
+		close(done)
+		<-watchDone
+	}()
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-done:
+			return
+		case st := <-s.gAssistant.StatusCh:
+			if st != embedded.ConverseResponse_END_OF_UTTERANCE {
+				return
+			}
+		}
+		glog.V(2).Infof("gAssisant sent END_OF_UTTERANCE")
+		stopListening()
+		if err := s.emotion.Expression(EMOTION_SPEAK, CH, 100); err != nil {
+			glog.Warningf("Failed to display emotion: %v", err)
+		}
+		s.watchBargeIn(barged, done)
+	}()
+
 	if err := s.emotion.Expression(EMOTION_BLINK, CH, 100); err != nil {
 		glog.Warningf("Failed to display emotion: %v", err)
 	}
-	audioOut := s.gAssistant.ConverseWithAssistant()
-
-	// Convert assistant audio to text.
-	txt, err := SpeechToText(audioOut)
+	res, err := s.gAssistant.ConverseWithAssistant()
+	stopListening()
+	if interrupted(barged) {
+		return true
+	}
 	if err != nil {
-		glog.Errorf("Failed to recognize speech: %v", err)
+		glog.Errorf("Conversation with assistant failed: %v", err)
+		rec.Error(err)
 		if err := s.emotion.Expression(EMOTION_SAD, CH, 9000); err != nil {
 			glog.Warningf("Failed to display emotion: %v", err)
 		}
-		return
+		return false
+	}
+	for _, err := range res.Errors {
+		rec.Error(err)
+	}
+	session := res.Session
+
+	// Use the assistant's own text of the reply, transcribing its audio only if
+	// there is none.
+	tr := stt.FromText(res.ResponseText)
+	if len(tr.Segments) > 0 {
+		transcriber.Cancel()
+	} else {
+		tr, err = s.transcribe(transcriber, res.Audio.Bytes())
 	}
-	glog.V(1).Infof("Google Assistant said: %v", txt)
-
-	// Get sentiment analysis of text.
-	score, magnitude, err := AnalyzeSentiment(txt)
 	if err != nil {
-		glog.Errorf("Failed to analyze sentiment: %v", err)
+		glog.Errorf("Failed to recognize speech: %v", err)
+		rec.Error(err)
 		if err := s.emotion.Expression(EMOTION_SAD, CH, 9000); err != nil {
 			glog.Warningf("Failed to display emotion: %v", err)
 		}
-		return
+		return false
+	}
+	txt := tr.Text()
+	glog.V(1).Infof("Google Assistant said: %v (confidence=%.3f language=%v)", txt, tr.Confidence(), tr.Language())
+	rec.Update(func(m *recorder.Meta) {
+		m.Transcript = txt
+		m.Confidence = tr.Confidence()
+	})
+
+	// The language the reply was heard in, else the one configured.
+	lang := tr.Language()
+	if lang == "" {
+		lang = s.language
+	}
+
+	// Text heard with low confidence is no guide to the emotion.
+	if c := tr.Confidence(); c > 0 && c < MIN_CONFIDENCE {
+		glog.V(1).Infof("Ignoring reply transcript with low confidence %.3f", c)
+		txt = ""
+	}
+
+	// Move the mouth with the words instead, from when the reply started.
+	if words := tr.Words(); s.lipSyncWords && len(words) > 0 && !transcriber.started.IsZero() {
+		stopLipSync()
+		stopLipSync = s.startWordSync(words, transcriber.started)
 	}
-	glog.V(1).Infof("Sentiment Analysis - Score:%v Magnitude:%v", score, magnitude)
 
-	// This channel signifies the end of speech output from Audio. Wait for
-	// audio playback completion before changing emotion.
-	<-s.audio.StatusCh
+	// Get sentiment analysis of text.
+	var score, magnitude float32
+	if txt != "" {
+		score, magnitude, err = transcriber.Analyze(txt, lang)
+		if err != nil {
+			glog.Errorf("Failed to analyze sentiment: %v", err)
+			rec.Error(err)
+			if err := s.emotion.Expression(EMOTION_SAD, CH, 9000); err != nil {
+				glog.Warningf("Failed to display emotion: %v", err)
+			}
+			return false
+		}
+		glog.V(1).Infof("Sentiment Analysis - Score:%v Magnitude:%v", score, magnitude)
+		rec.Update(func(m *recorder.Meta) {
+			m.SentimentScore = score
+			m.SentimentMagnitude = magnitude
+		})
+	}
+
+	// Wait for the reply to finish playing before changing emotion.
+	select {
+	case <-session.Done():
+	case <-barged:
+		return true
+	}
+	stopLipSync()
 	if err := s.emotion.Expression(EMOTION_THINKING, CH, 100); err != nil {
 		glog.Warningf("Failed to display emotion: %v", err)
 	}
 
 	// Select an emotion to display.
-	emotion := selectEmotion(score, txt)
+	emotion := selectEmotion(score, txt, s.keywords.Lookup(lang))
+	rec.Update(func(m *recorder.Meta) { m.Emotion = EMOTION_NAMES[emotion] })
 	if err := s.emotion.Expression(emotion, CH, 500); err != nil {
 		glog.Warningf("Failed to display emotion: %v", err)
 	}
 
 	glog.V(2).Info("gAssistant interaction complete")
-
+	return false
 }